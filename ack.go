@@ -0,0 +1,209 @@
+package orgreminders
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// Actions a member can take from the links in a reminder.
+const (
+	AckGotIt  = "ack"
+	AckSnooze = "snooze"
+)
+
+// How long a snooze delays the extra reminder.
+var SnoozeDuration = time.Hour
+
+// A member's response to an event's reminders.
+type Ack struct {
+	Key              string `datastore:"-"`
+	Event            string
+	Member           string
+	MemberName       string
+	Action           string
+	Created          time.Time
+	Until            time.Time
+	Sent             bool
+	CreatedFormatted string `datastore:"-"`
+	UntilFormatted   string `datastore:"-"`
+}
+
+type Acks []Ack
+
+func (slice Acks) Len() int {
+	return len(slice)
+}
+
+func (slice Acks) Less(i, j int) bool {
+	return slice[i].Created.Before(slice[j].Created)
+}
+
+func (slice Acks) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+func NewAck(event string, member Member, action string, now time.Time) Ack {
+	ack := Ack{
+		Event:      event,
+		Member:     member.Key,
+		MemberName: member.Name,
+		Action:     action,
+		Created:    now.UTC(),
+	}
+
+	if action == AckSnooze {
+		ack.Until = ack.Created.Add(SnoozeDuration)
+	}
+
+	return ack
+}
+
+// Save an acknowledgement to the database
+func (a Ack) Save(c appengine.Context) (bool, string) {
+	key := datastore.NewIncompleteKey(c, "Ack", nil)
+	keyNew, err := datastore.Put(c, key, &a)
+	if err != nil {
+		c.Errorf("Ack.Save error: %v", err)
+		return false, ""
+	}
+
+	return true, keyNew.Encode()
+}
+
+func (a Ack) Update(c appengine.Context) bool {
+	keyObj, decerr := datastore.DecodeKey(a.Key)
+	if decerr != nil {
+		c.Infof("Invalid key specified")
+		return false
+	}
+
+	_, err := datastore.Put(c, keyObj, &a)
+	if err != nil {
+		c.Errorf("Ack.Update error: %v", err)
+		return false
+	}
+
+	return true
+}
+
+// All acknowledgements and snoozes recorded for an event, oldest first.
+func GetAcksByEvent(c appengine.Context, eventKey string) Acks {
+	var dbResults Acks
+
+	q := datastore.NewQuery("Ack").Filter("Event = ", eventKey)
+	keys, err := q.GetAll(c, &dbResults)
+	if err != nil {
+		c.Infof("GetAcksByEvent DB lookup error: %v", err)
+	}
+
+	for indx := range dbResults {
+		dbResults[indx].Key = keys[indx].Encode()
+	}
+
+	sort.Sort(dbResults)
+	return dbResults
+}
+
+// Keys of the members who have said "got it" for an event.
+func AckedMembers(c appengine.Context, eventKey string) map[string]bool {
+	return AckedMembersSince(c, eventKey, time.Time{})
+}
+
+// Keys of the members who have said "got it" for an event after since.
+func AckedMembersSince(c appengine.Context, eventKey string, since time.Time) map[string]bool {
+	var result = make(map[string]bool)
+
+	for _, ack := range GetAcksByEvent(c, eventKey) {
+		if ack.Action == AckGotIt && ack.Created.After(since) {
+			result[ack.Member] = true
+		}
+	}
+
+	return result
+}
+
+// The recipients whose member has not said "got it" yet.
+func Unacknowledged(rcpts []Recipient, acked map[string]bool) []Recipient {
+	var result []Recipient
+
+	for _, rcpt := range rcpts {
+		if acked[rcpt.Member.Key] == false {
+			result = append(result, rcpt)
+		}
+	}
+
+	return result
+}
+
+// Snoozes whose extra reminder is due and has not been sent yet.
+func GetDueSnoozes(c appengine.Context, clock Clock) Acks {
+	var dbResults Acks
+	var result = Acks{}
+
+	q := datastore.NewQuery("Ack").Filter("Action = ", AckSnooze).Filter("Sent = ", false)
+	keys, err := q.GetAll(c, &dbResults)
+	if err != nil {
+		c.Infof("GetDueSnoozes DB lookup error: %v", err)
+	}
+
+	for indx, ack := range dbResults {
+		if ack.Until.After(clock.Now()) {
+			continue
+		}
+		ack.Key = keys[indx].Encode()
+		result = append(result, ack)
+	}
+
+	return result
+}
+
+// Signed link a member can follow to acknowledge or snooze an event.
+func AckLink(c appengine.Context, eventKey string, memberKey string, action string) string {
+	v := url.Values{}
+	v.Set("e", eventKey)
+	v.Set("m", memberKey)
+	v.Set("a", action)
+	v.Set("s", Sign(c, "ack", eventKey, memberKey, action))
+
+	return fmt.Sprintf("https://%s/ack?%s", appengine.DefaultVersionHostname(c), v.Encode())
+}
+
+// Send the one-off extra reminders for snoozes that have come due.
+func SendSnoozes(c appengine.Context, clock Clock, dryrun bool) (reminders Reminders) {
+	for _, snooze := range GetDueSnoozes(c, clock) {
+		reminders = append(reminders, SendSnooze(c, clock, snooze, dryrun)...)
+	}
+
+	return
+}
+
+// Send the extra reminder of a single snooze and mark it sent.
+func SendSnooze(c appengine.Context, clock Clock, snooze Ack, dryrun bool) (reminders Reminders) {
+	okay, event := GetEventByKey(c, snooze.Event)
+	if okay != true {
+		c.Infof("SendSnoozes: Error querying for event %s", snooze.Event)
+		return
+	}
+
+	okay, member := GetMemberByKey(c, snooze.Member)
+	if okay != true {
+		c.Infof("SendSnoozes: Error querying for member %s", snooze.Member)
+		return
+	}
+
+	// A later "got it" cancels the snooze
+	if AckedMembers(c, event.Key)[member.Key] == false {
+		reminders = event.NotifyMember(c, clock, member, AckSnooze, dryrun)
+	}
+
+	if dryrun == false {
+		snooze.Sent = true
+		snooze.Update(c)
+	}
+
+	return
+}
@@ -0,0 +1,140 @@
+package orgreminders
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+)
+
+// Layout of holiday dates.
+const HolidayLayout = "2006-01-02"
+
+// Working days of an organization, used for business day offsets.
+type Calendar struct {
+	// Working weekdays (time.Weekday values), Monday to Friday when empty
+	Workweek []int
+	// Non-working dates, "2006-01-02" optionally followed by a name
+	Holidays []string
+}
+
+// Whether the date of t is a working day.
+func (cal Calendar) WorkingDay(t time.Time) bool {
+	var workweek = cal.Workweek
+	if len(workweek) == 0 {
+		workweek = []int{1, 2, 3, 4, 5}
+	}
+
+	var working bool
+	for _, day := range workweek {
+		if time.Weekday(day) == t.Weekday() {
+			working = true
+			break
+		}
+	}
+	if working == false {
+		return false
+	}
+
+	var date = t.Format(HolidayLayout)
+	for _, holiday := range cal.Holidays {
+		if strings.HasPrefix(holiday, date) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Move t by n working days (backwards when n is negative), keeping its
+// wall clock time.
+func (cal Calendar) AddBusinessDays(t time.Time, n int) time.Time {
+	var step = 1
+	if n < 0 {
+		step = -1
+		n = -n
+	}
+
+	// Give up rather than loop forever on a calendar without working days
+	for tries := 0; n > 0 && tries < 3660; tries++ {
+		t = time.Date(t.Year(), t.Month(), t.Day()+step, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+		if cal.WorkingDay(t) {
+			n--
+		}
+	}
+
+	return t
+}
+
+// Read the all-day events of an iCalendar (.ics) file as holiday entries.
+// Events with a time of day (DTSTART without VALUE=DATE) are meetings and
+// the like rather than days off, so they are skipped.
+func ParseICSHolidays(r io.Reader) ([]string, error) {
+	var result []string
+	var lines []string
+
+	// Unfold continuation lines
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var line = strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var inEvent, allDay bool
+	var start, end time.Time
+	var summary string
+	for _, line := range lines {
+		var colon = strings.Index(line, ":")
+		if colon < 0 {
+			continue
+		}
+		var name = strings.ToUpper(line[:colon])
+		var value = line[colon+1:]
+		var params string
+		if semi := strings.Index(name, ";"); semi >= 0 {
+			name, params = name[:semi], name[semi:]
+		}
+
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			inEvent, allDay = true, false
+			start, end, summary = time.Time{}, time.Time{}, ""
+		case name == "END" && value == "VEVENT":
+			inEvent = false
+			if start.IsZero() || allDay == false {
+				continue
+			}
+			if end.IsZero() || !end.After(start) {
+				end = start.AddDate(0, 0, 1)
+			}
+			for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+				result = append(result, strings.TrimSpace(day.Format(HolidayLayout)+" "+summary))
+			}
+		case inEvent && (name == "DTSTART" || name == "DTEND"):
+			if len(value) < 8 {
+				continue
+			}
+			date, err := time.Parse("20060102", value[:8])
+			if err != nil {
+				continue
+			}
+			if name == "DTSTART" {
+				start = date
+				allDay = strings.Contains(params+";", ";VALUE=DATE;")
+			} else {
+				end = date
+			}
+		case inEvent && name == "SUMMARY":
+			summary = strings.Replace(value, "\\,", ",", -1)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,120 @@
+package orgreminders
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 2014-03-10 is a Monday
+func testDay(d int, h int) time.Time {
+	return time.Date(2014, 3, d, h, 0, 0, 0, time.UTC)
+}
+
+func TestCalendarWorkingDay(t *testing.T) {
+	var cal = Calendar{Holidays: []string{"2014-03-12 Founders' day", "2014-03-17"}}
+	var sixDays = Calendar{Workweek: []int{1, 2, 3, 4, 5, 6}}
+
+	var tests = []struct {
+		name string
+		cal  Calendar
+		day  time.Time
+		want bool
+	}{
+		{"monday", cal, testDay(10, 9), true},
+		{"friday", cal, testDay(14, 9), true},
+		{"saturday", cal, testDay(15, 9), false},
+		{"sunday", cal, testDay(16, 9), false},
+		{"named holiday", cal, testDay(12, 9), false},
+		{"bare holiday", cal, testDay(17, 23), false},
+		{"six day week saturday", sixDays, testDay(15, 9), true},
+		{"six day week sunday", sixDays, testDay(16, 9), false},
+	}
+
+	for _, test := range tests {
+		if got := test.cal.WorkingDay(test.day); got != test.want {
+			t.Errorf("%s: WorkingDay(%v) = %v, want %v", test.name, test.day, got, test.want)
+		}
+	}
+}
+
+func TestCalendarAddBusinessDays(t *testing.T) {
+	var cal = Calendar{Holidays: []string{"2014-03-12", "2014-03-13", "2014-03-14 Long weekend"}}
+
+	var tests = []struct {
+		name string
+		cal  Calendar
+		from time.Time
+		n    int
+		want time.Time
+	}{
+		{"zero", Calendar{}, testDay(15, 9), 0, testDay(15, 9)},
+		{"next day", Calendar{}, testDay(10, 9), 1, testDay(11, 9)},
+		{"over weekend", Calendar{}, testDay(14, 9), 1, testDay(17, 9)},
+		{"from weekend", Calendar{}, testDay(15, 9), 1, testDay(17, 9)},
+		{"week", Calendar{}, testDay(10, 9), 5, testDay(17, 9)},
+		{"back over weekend", Calendar{}, testDay(17, 9), -1, testDay(14, 9)},
+		{"back a week", Calendar{}, testDay(17, 9), -5, testDay(10, 9)},
+		{"holiday run", cal, testDay(11, 9), 1, testDay(17, 9)},
+		{"back over holiday run", cal, testDay(17, 9), -1, testDay(11, 9)},
+		{"back into holiday run", cal, testDay(18, 9), -2, testDay(11, 9)},
+		{"no working days", Calendar{Workweek: []int{9}}, testDay(10, 9), 1, testDay(10, 9).AddDate(0, 0, 3660)},
+	}
+
+	for _, test := range tests {
+		if got := test.cal.AddBusinessDays(test.from, test.n); !got.Equal(test.want) {
+			t.Errorf("%s: AddBusinessDays(%v, %d) = %v, want %v", test.name, test.from, test.n, got, test.want)
+		}
+	}
+}
+
+func TestParseICSHolidays(t *testing.T) {
+	var ics = strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VEVENT",
+		"DTSTART;VALUE=DATE:20141225",
+		"DTEND;VALUE=DATE:20141226",
+		"SUMMARY:Christmas Day",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"DTSTART;VALUE=DATE:20141127",
+		"DTEND;VALUE=DATE:20141129",
+		"SUMMARY:Thanksgiving\\, and the day",
+		"  after",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"dtstart;value=date:20140704",
+		"SUMMARY:Independence Day",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"DTSTART:20141201T140000Z",
+		"DTEND:20141201T160000Z",
+		"SUMMARY:Budget meeting",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"DTSTART;TZID=America/Chicago:20141202T090000",
+		"SUMMARY:Standup",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"SUMMARY:No date",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	got, err := ParseICSHolidays(strings.NewReader(ics))
+	if err != nil {
+		t.Fatalf("ParseICSHolidays error: %v", err)
+	}
+
+	want := []string{
+		"2014-12-25 Christmas Day",
+		"2014-11-27 Thanksgiving, and the day after",
+		"2014-11-28 Thanksgiving, and the day after",
+		"2014-07-04 Independence Day",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseICSHolidays = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,207 @@
+package orgreminders
+
+import (
+	"appengine"
+	"appengine/urlfetch"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Chat platforms an organization can post reminders to, by the payload
+// their incoming webhooks expect.
+const (
+	ChatSlack      = "slack"
+	ChatMattermost = "mattermost"
+	ChatDiscord    = "discord"
+)
+
+// Longest message text posted to chat, the rest is behind the link.
+const chatTextLength = 1000
+
+// An incoming webhook of a chat platform.
+type ChatHook struct {
+	Format string
+	URL    string
+}
+
+// A reminder as posted to chat.
+type ChatMessage struct {
+	Title string
+	Due   time.Time
+	Zone  *time.Location
+	Link  string
+	Text  string
+}
+
+// Parse a webhook entered as "<format> <url>". The format may be left out
+// for Slack and Discord, whose webhook URLs give them away.
+func ParseChatHook(line string) (ChatHook, error) {
+	var hook ChatHook
+	var fields = strings.Fields(line)
+
+	switch len(fields) {
+	case 1:
+		hook.URL = fields[0]
+	case 2:
+		hook.Format = strings.ToLower(fields[0])
+		hook.URL = fields[1]
+	default:
+		return hook, errors.New("expected a format and a URL")
+	}
+
+	u, err := url.Parse(hook.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return hook, errors.New("invalid webhook URL")
+	}
+
+	if hook.Format == "" {
+		switch {
+		case u.Host == "hooks.slack.com":
+			hook.Format = ChatSlack
+		case u.Host == "discord.com" || u.Host == "discordapp.com":
+			hook.Format = ChatDiscord
+		default:
+			return hook, errors.New("start the line with slack, mattermost or discord")
+		}
+	}
+
+	if hook.Format != ChatSlack && hook.Format != ChatMattermost && hook.Format != ChatDiscord {
+		return hook, errors.New("unknown chat format " + hook.Format)
+	}
+
+	return hook, nil
+}
+
+// Where the hook posts, without the secret part of its URL.
+func (h ChatHook) String() string {
+	if u, err := url.Parse(h.URL); err == nil {
+		return h.Format + " " + u.Host
+	}
+
+	return h.Format
+}
+
+// Request body for posting msg in the given format.
+func ChatPayload(format string, msg ChatMessage) ([]byte, error) {
+	var due = msg.Due.In(msg.Zone).Format("01/02/2006 3:04pm MST")
+	var text = chatTrim(strings.TrimSpace(msg.Text), chatTextLength)
+	var payload interface{}
+
+	switch format {
+	case ChatSlack:
+		escape := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace
+		body := fmt.Sprintf("*<%s|%s>*\nDue: %s", msg.Link, escape(msg.Title), due)
+		if text != "" {
+			body += "\n\n" + escape(text)
+		}
+		payload = map[string]string{"text": body}
+
+	case ChatMattermost:
+		escape := strings.NewReplacer("\\", "\\\\", "[", "\\[", "]", "\\]", "*", "\\*", "_", "\\_", "`", "\\`").Replace
+		body := fmt.Sprintf("#### [%s](%s)\n**Due:** %s", escape(msg.Title), msg.Link, due)
+		if text != "" {
+			body += "\n\n" + text
+		}
+		payload = map[string]string{"text": body}
+
+	case ChatDiscord:
+		description := "**Due:** " + due
+		if text != "" {
+			description += "\n\n" + text
+		}
+		payload = map[string]interface{}{
+			"embeds": []map[string]string{{
+				"title":       chatTrim(msg.Title, 256),
+				"url":         msg.Link,
+				"description": description,
+				"timestamp":   msg.Due.UTC().Format(time.RFC3339),
+			}},
+		}
+
+	default:
+		return nil, errors.New("unknown chat format " + format)
+	}
+
+	return json.Marshal(payload)
+}
+
+// Post msg to the hook. Anything but a 2xx response is an error.
+func PostChat(client *http.Client, hook ChatHook, msg ChatMessage) error {
+	body, err := ChatPayload(hook.Format, msg)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post(hook.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 200))
+		return fmt.Errorf("%s: %s %s", hook, resp.Status, strings.TrimSpace(string(detail)))
+	}
+
+	return nil
+}
+
+// Post the event to the chat webhooks of the organizations, once per
+// webhook. Returns whether all posts went through, and where they went.
+func SendChatMessage(c appengine.Context, clock Clock, orgs []Organization, e Event, dryrun bool) (result bool, hooks []string) {
+	var client = urlfetch.Client(c)
+	var seen = make(map[string]bool)
+	result = true
+
+	for _, o := range orgs {
+		for _, hook := range o.ChatHooks() {
+			if seen[hook.URL] {
+				continue
+			}
+			seen[hook.URL] = true
+
+			var rcpt = Recipient{Member: Member{Name: "everyone"}, Org: o}
+			var vars = NewMessageVars(e, rcpt, clock.Now())
+			var msg = ChatMessage{
+				Title: e.Title,
+				Due:   e.Due,
+				Zone:  e.Zone(o),
+				Link:  fmt.Sprintf("https://%s/editevent?id=%s", appengine.DefaultVersionHostname(c), e.Key),
+				Text:  vars.SMS(e),
+			}
+
+			hooks = append(hooks, hook.String())
+			if dryrun {
+				c.Infof("dry run, not posting (%s): %v", e.Title, hook)
+				continue
+			}
+
+			c.Infof("notify (%s): %v", e.Title, hook)
+			if err := PostChat(client, hook, msg); err != nil {
+				c.Errorf("Couldn't post to chat: %v", err)
+				result = false
+			}
+		}
+	}
+
+	return
+}
+
+// Cut s to at most n characters, ending with "..." when shortened.
+func chatTrim(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:n-3])) + "..."
+}
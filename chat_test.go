@@ -0,0 +1,134 @@
+package orgreminders
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testChatMessage = ChatMessage{
+	Title: "Budget <due> & review",
+	Due:   time.Date(2014, 3, 10, 14, 30, 0, 0, time.UTC),
+	Zone:  time.FixedZone("CDT", -5*3600),
+	Link:  "https://orgreminders.appspot.com/editevent?id=abc",
+	Text:  "Send *your* numbers",
+}
+
+// A chat webhook that records what was posted to it and answers with
+// status.
+func testChatServer(status int) (*httptest.Server, *[]byte) {
+	var body []byte
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(status)
+		w.Write([]byte("no_text"))
+	}))
+
+	return server, &body
+}
+
+func TestPostChat(t *testing.T) {
+	var tests = []struct {
+		format string
+		want   map[string]interface{}
+	}{
+		{ChatSlack, map[string]interface{}{
+			"text": "*<https://orgreminders.appspot.com/editevent?id=abc|Budget &lt;due&gt; &amp; review>*\nDue: 03/10/2014 9:30am CDT\n\nSend *your* numbers",
+		}},
+		{ChatMattermost, map[string]interface{}{
+			"text": "#### [Budget <due> & review](https://orgreminders.appspot.com/editevent?id=abc)\n**Due:** 03/10/2014 9:30am CDT\n\nSend *your* numbers",
+		}},
+		{ChatDiscord, map[string]interface{}{
+			"embeds": []interface{}{map[string]interface{}{
+				"title":       "Budget <due> & review",
+				"url":         "https://orgreminders.appspot.com/editevent?id=abc",
+				"description": "**Due:** 03/10/2014 9:30am CDT\n\nSend *your* numbers",
+				"timestamp":   "2014-03-10T14:30:00Z",
+			}},
+		}},
+	}
+
+	for _, test := range tests {
+		server, body := testChatServer(http.StatusOK)
+
+		err := PostChat(http.DefaultClient, ChatHook{Format: test.format, URL: server.URL}, testChatMessage)
+		server.Close()
+		if err != nil {
+			t.Errorf("%s: PostChat error: %v", test.format, err)
+			continue
+		}
+
+		var got map[string]interface{}
+		if err := json.Unmarshal(*body, &got); err != nil {
+			t.Errorf("%s: invalid JSON posted: %v: %s", test.format, err, *body)
+			continue
+		}
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(test.want)
+		if string(gotJSON) != string(wantJSON) {
+			t.Errorf("%s: posted %s, want %s", test.format, gotJSON, wantJSON)
+		}
+	}
+}
+
+func TestPostChatError(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError} {
+		server, _ := testChatServer(status)
+		hook := ChatHook{Format: ChatSlack, URL: server.URL + "/services/SECRET"}
+
+		err := PostChat(http.DefaultClient, hook, testChatMessage)
+		server.Close()
+		if err == nil {
+			t.Errorf("status %d: PostChat succeeded, want an error", status)
+			continue
+		}
+		if !strings.Contains(err.Error(), http.StatusText(status)) || strings.Contains(err.Error(), "SECRET") {
+			t.Errorf("status %d: error %q should give the status without the URL path", status, err)
+		}
+	}
+
+	if err := PostChat(http.DefaultClient, ChatHook{Format: "teams", URL: "https://example.com/"}, testChatMessage); err == nil {
+		t.Errorf("unknown format: PostChat succeeded, want an error")
+	}
+}
+
+func TestParseChatHook(t *testing.T) {
+	var tests = []struct {
+		line   string
+		format string
+		ok     bool
+	}{
+		{"https://hooks.slack.com/services/T0/B0/x", ChatSlack, true},
+		{"https://discord.com/api/webhooks/1/x", ChatDiscord, true},
+		{"Mattermost https://chat.example.com/hooks/x", ChatMattermost, true},
+		{"slack https://chat.example.com/hooks/x", ChatSlack, true},
+		{"https://chat.example.com/hooks/x", "", false},
+		{"teams https://example.com/x", "teams", false},
+		{"slack ftp://example.com/x", ChatSlack, false},
+		{"slack https://example.com/x extra", "", false},
+	}
+
+	for _, test := range tests {
+		hook, err := ParseChatHook(test.line)
+		if (err == nil) != test.ok || hook.Format != test.format {
+			t.Errorf("ParseChatHook(%q) = %q, %v; want %q, ok %v", test.line, hook.Format, err, test.format, test.ok)
+		}
+	}
+}
+
+func TestValidateChatHooksHidesURL(t *testing.T) {
+	o := Organization{ChatWebhooks: []string{"teams https://example.com/hooks/SECRET", "not a webhook at all"}}
+
+	if msg := o.Validate()["chathooks"]; msg == "" || strings.Contains(msg, "SECRET") || !strings.Contains(msg, "example.com") {
+		t.Errorf("chathooks error %q should name the host only", msg)
+	}
+}
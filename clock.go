@@ -0,0 +1,26 @@
+package orgreminders
+
+import (
+	"time"
+)
+
+// Clock tells the scheduling code what time it is.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock reads the real wall clock.
+var SystemClock Clock = systemClock{}
+
+// FixedClock always reports the same instant.
+type FixedClock time.Time
+
+func (f FixedClock) Now() time.Time {
+	return time.Time(f)
+}
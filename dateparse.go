@@ -0,0 +1,192 @@
+package orgreminders
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Layout the Due field is shown in, and the first one tried when parsing.
+const DueLayout = "01/02/2006 3:04pm"
+
+// Absolute layouts accepted for due dates. Layouts without a zone are read
+// in the event's time zone.
+var dueLayouts = []string{
+	DueLayout,
+	"01/02/2006 3:04 pm",
+	"01/02/2006 3pm",
+	"01/02/2006 15:04",
+	"01/02/2006",
+	"1/2/2006 3:04pm",
+	"1/2/2006 3:04 pm",
+	"1/2/2006 15:04",
+	"1/2/2006",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02 3:04pm",
+	"2006-01-02 3:04 pm",
+	"2006-01-02",
+	"Jan 2, 2006 3:04pm",
+	"Jan 2, 2006 15:04",
+	"Jan 2 2006 3:04pm",
+	"January 2, 2006 3:04pm",
+	"January 2, 2006 15:04",
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "sun": time.Sunday,
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday, "tues": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+}
+
+var reRelative = regexp.MustCompile(`^in (\d+|an?) (minute|min|hour|hr|day|week)s?(?: (?:at )?(.+))?$`)
+var reDayTime = regexp.MustCompile(`^(today|tonight|tomorrow|next [a-z]+|this [a-z]+|[a-z]+)(?: (?:at )?(.+))?$`)
+var reTimeOfDay = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))? ?(am|pm|a\.m\.|p\.m\.)?$`)
+
+// Hour used when a relative date is given without a time of day.
+const defaultDueHour = 9
+
+// Parse a due date as typed by a person. Besides the layouts above it
+// understands phrases like "tomorrow 5pm", "next tuesday 7pm" and
+// "in 3 days at noon", all relative to now and in now's location.
+func ParseDue(value string, now time.Time) (time.Time, error) {
+	var loc = now.Location()
+	var text = strings.Join(strings.Fields(strings.ToLower(value)), " ")
+
+	if text == "" {
+		return time.Time{}, fmt.Errorf("a due date is required")
+	}
+
+	// ISO 8601 wants its "T" and "Z" upper case, the rest does not care
+	for _, layout := range dueLayouts {
+		if t, err := time.ParseInLocation(layout, strings.TrimSpace(value), loc); err == nil {
+			return t, nil
+		}
+		if t, err := time.ParseInLocation(layout, text, loc); err == nil {
+			return t, nil
+		}
+	}
+
+	// "in 3 days at noon", "in 2 hours"
+	if m := reRelative.FindStringSubmatch(text); m != nil {
+		var n = 1
+		if m[1] != "a" && m[1] != "an" {
+			n, _ = strconv.Atoi(m[1])
+		}
+
+		switch m[2] {
+		case "minute", "min":
+			if m[3] == "" {
+				return now.Add(time.Duration(n) * time.Minute).Truncate(time.Minute), nil
+			}
+		case "hour", "hr":
+			if m[3] == "" {
+				return now.Add(time.Duration(n) * time.Hour).Truncate(time.Minute), nil
+			}
+		case "day", "week":
+			var days = n
+			if m[2] == "week" {
+				days = 7 * n
+			}
+			var date = now.AddDate(0, 0, days)
+			if m[3] == "" {
+				return time.Date(date.Year(), date.Month(), date.Day(), now.Hour(), now.Minute(), 0, 0, loc), nil
+			}
+			return atTimeOfDay(date, m[3], value)
+		}
+
+		return time.Time{}, dueError(value, now)
+	}
+
+	// "tomorrow 5pm", "next tuesday at 7:30pm", "friday noon"
+	if m := reDayTime.FindStringSubmatch(text); m != nil {
+		var date time.Time
+		var day = m[1]
+		var clock = m[2]
+
+		switch {
+		case day == "today":
+			date = now
+		case day == "tonight":
+			date = now
+			if clock == "" {
+				clock = "8pm"
+			}
+		case day == "tomorrow":
+			date = now.AddDate(0, 0, 1)
+		default:
+			var strict bool
+			if strings.HasPrefix(day, "next ") {
+				strict = true
+				day = strings.TrimPrefix(day, "next ")
+			}
+			day = strings.TrimPrefix(day, "this ")
+
+			weekday, ok := weekdays[day]
+			if !ok {
+				return time.Time{}, dueError(value, now)
+			}
+
+			var ahead = (int(weekday) - int(now.Weekday()) + 7) % 7
+			if ahead == 0 && strict {
+				ahead = 7
+			}
+			date = now.AddDate(0, 0, ahead)
+		}
+
+		if clock == "" {
+			return time.Date(date.Year(), date.Month(), date.Day(), defaultDueHour, 0, 0, 0, loc), nil
+		}
+		return atTimeOfDay(date, clock, value)
+	}
+
+	return time.Time{}, dueError(value, now)
+}
+
+func dueError(value string, now time.Time) error {
+	return fmt.Errorf("could not understand due date %q, try something like %q or \"next tuesday 7pm\"", value, now.Format(DueLayout))
+}
+
+// Put date at the given time of day ("7pm", "19:30", "noon", ...).
+func atTimeOfDay(date time.Time, clock string, value string) (time.Time, error) {
+	var hour, minute int
+
+	switch clock {
+	case "noon", "midday":
+		hour = 12
+	case "midnight":
+		hour = 0
+	default:
+		m := reTimeOfDay.FindStringSubmatch(clock)
+		if m == nil {
+			return time.Time{}, fmt.Errorf("could not understand the time in %q", value)
+		}
+
+		hour, _ = strconv.Atoi(m[1])
+		if m[2] != "" {
+			minute, _ = strconv.Atoi(m[2])
+		}
+
+		var meridiem = strings.Replace(m[3], ".", "", -1)
+		if hour > 23 || minute > 59 || (meridiem != "" && (hour < 1 || hour > 12)) {
+			return time.Time{}, fmt.Errorf("could not understand the time in %q", value)
+		}
+
+		if meridiem == "am" && hour == 12 {
+			hour = 0
+		} else if meridiem == "pm" && hour < 12 {
+			hour += 12
+		}
+	}
+
+	return time.Date(date.Year(), date.Month(), date.Day(), hour, minute, 0, 0, date.Location()), nil
+}
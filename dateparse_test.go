@@ -0,0 +1,93 @@
+package orgreminders
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDue(t *testing.T) {
+	chicago, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Skip("no time zone data")
+	}
+
+	// A Wednesday morning
+	var now = time.Date(2014, 3, 12, 10, 15, 30, 0, chicago)
+
+	var tests = []struct {
+		name string
+		in   string
+		want time.Time
+	}{
+		{"iso offset", "2014-03-20T15:00:00-07:00", time.Date(2014, 3, 20, 22, 0, 0, 0, time.UTC)},
+		{"iso utc", "2014-03-20T15:00:00Z", time.Date(2014, 3, 20, 15, 0, 0, 0, time.UTC)},
+		{"iso local", "2014-03-20T15:00", time.Date(2014, 3, 20, 15, 0, 0, 0, chicago)},
+		{"iso date", "2014-03-20", time.Date(2014, 3, 20, 0, 0, 0, 0, chicago)},
+		{"12 hour", "03/20/2014 3:04pm", time.Date(2014, 3, 20, 15, 4, 0, 0, chicago)},
+		{"12 hour spaced upper case", "3/20/2014 3:30 PM", time.Date(2014, 3, 20, 15, 30, 0, 0, chicago)},
+		{"12 hour midnight", "03/20/2014 12:00am", time.Date(2014, 3, 20, 0, 0, 0, 0, chicago)},
+		{"24 hour", "03/20/2014 15:30", time.Date(2014, 3, 20, 15, 30, 0, 0, chicago)},
+		{"month name", "March 20, 2014 7:30pm", time.Date(2014, 3, 20, 19, 30, 0, 0, chicago)},
+		{"month first", "04/03/2014", time.Date(2014, 4, 3, 0, 0, 0, 0, chicago)},
+		{"past date", "03/01/2014 9:00", time.Date(2014, 3, 1, 9, 0, 0, 0, chicago)},
+
+		{"tomorrow", "tomorrow 9am", time.Date(2014, 3, 13, 9, 0, 0, 0, chicago)},
+		{"tomorrow at", "Tomorrow at 17:45", time.Date(2014, 3, 13, 17, 45, 0, 0, chicago)},
+		{"tomorrow no time", "tomorrow", time.Date(2014, 3, 13, 9, 0, 0, 0, chicago)},
+		{"tonight", "tonight", time.Date(2014, 3, 12, 20, 0, 0, 0, chicago)},
+		{"today noon", "today noon", time.Date(2014, 3, 12, 12, 0, 0, 0, chicago)},
+		{"next tuesday", "next tuesday 7pm", time.Date(2014, 3, 18, 19, 0, 0, 0, chicago)},
+		{"next same weekday", "next wednesday", time.Date(2014, 3, 19, 9, 0, 0, 0, chicago)},
+		{"same weekday", "wednesday 5pm", time.Date(2014, 3, 12, 17, 0, 0, 0, chicago)},
+		{"short weekday", "fri 12am", time.Date(2014, 3, 14, 0, 0, 0, 0, chicago)},
+		{"dotted meridiem", "thursday 7:30 p.m.", time.Date(2014, 3, 13, 19, 30, 0, 0, chicago)},
+		{"in days at noon", "in 3 days at noon", time.Date(2014, 3, 15, 12, 0, 0, 0, chicago)},
+		{"in days", "in 2 days", time.Date(2014, 3, 14, 10, 15, 0, 0, chicago)},
+		{"in a week", "in a week", time.Date(2014, 3, 19, 10, 15, 0, 0, chicago)},
+		{"in hours", "in 2 hours", time.Date(2014, 3, 12, 12, 15, 0, 0, chicago)},
+		{"in minutes", "in 45 mins", time.Date(2014, 3, 12, 11, 0, 0, 0, chicago)},
+		{"extra spaces", "  next   tuesday   at  7pm ", time.Date(2014, 3, 18, 19, 0, 0, 0, chicago)},
+	}
+
+	for _, test := range tests {
+		got, err := ParseDue(test.in, now)
+		if err != nil {
+			t.Errorf("%s: ParseDue(%q) error: %v", test.name, test.in, err)
+			continue
+		}
+		if !got.Equal(test.want) {
+			t.Errorf("%s: ParseDue(%q) = %v, want %v", test.name, test.in, got, test.want)
+		}
+	}
+}
+
+func TestParseDueErrors(t *testing.T) {
+	var now = time.Date(2014, 3, 12, 10, 15, 0, 0, time.UTC)
+
+	var tests = []struct {
+		in   string
+		want string
+	}{
+		{"", "a due date is required"},
+		{"   ", "a due date is required"},
+		{"yesterday", `could not understand due date "yesterday", try something like "03/12/2014 10:15am" or "next tuesday 7pm"`},
+		{"13/40/2014", `could not understand due date "13/40/2014", try something like "03/12/2014 10:15am" or "next tuesday 7pm"`},
+		{"next blursday", `could not understand due date "next blursday", try something like "03/12/2014 10:15am" or "next tuesday 7pm"`},
+		{"in 3 minutes at noon", `could not understand due date "in 3 minutes at noon", try something like "03/12/2014 10:15am" or "next tuesday 7pm"`},
+		{"tomorrow 25:00", `could not understand the time in "tomorrow 25:00"`},
+		{"tomorrow 13pm", `could not understand the time in "tomorrow 13pm"`},
+		{"friday 0am", `could not understand the time in "friday 0am"`},
+		{"in 2 days at lunch", `could not understand the time in "in 2 days at lunch"`},
+	}
+
+	for _, test := range tests {
+		_, err := ParseDue(test.in, now)
+		if err == nil {
+			t.Errorf("ParseDue(%q) succeeded, want error %q", test.in, test.want)
+			continue
+		}
+		if err.Error() != test.want {
+			t.Errorf("ParseDue(%q) error %q, want %q", test.in, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package orgreminders
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"appengine/mail"
+	"bytes"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"time"
+)
+
+// How often a member gets a digest instead of individual reminders.
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// Digests go out at this hour of the member's day, weekly ones on
+// DigestWeekday.
+const DigestHour = 7
+
+var DigestWeekday = time.Monday
+
+// Whether the member gets e in their digest rather than as individual
+// reminders. Urgent events are always sent right away, and members who
+// have email switched off (or unsubscribed from the event's orgs) get no
+// digest of it, so they keep their texts.
+func (m Member) Digesting(e Event) bool {
+	if m.Digest == "" || m.EmailOn == false || m.Email == "" || e.Urgent {
+		return false
+	}
+
+	for _, orgname := range e.Orgs {
+		for _, morg := range m.Orgs {
+			if morg == orgname && m.OptedOut(orgname, "email") == false {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Time zone of the member. Members without one use the zone of their
+// first organization.
+func (m Member) Location(c appengine.Context) *time.Location {
+	if m.TimeZone != "" {
+		if location, err := time.LoadLocation(m.TimeZone); err == nil {
+			return location
+		}
+		c.Infof("Member %s has an invalid time zone: %s", m.Name, m.TimeZone)
+	}
+
+	if len(m.Orgs) == 0 {
+		return time.UTC
+	}
+
+	o, _ := GetOrganizationByName(c, m.Orgs[0])
+	return o.Location()
+}
+
+// When the member's current digest period started, given now in their
+// zone: today's (or this week's) digest hour.
+func (m Member) DigestPeriod(now time.Time) time.Time {
+	var start = time.Date(now.Year(), now.Month(), now.Day(), DigestHour, 0, 0, 0, now.Location())
+
+	if m.Digest == DigestWeekly {
+		start = start.AddDate(0, 0, -int((now.Weekday()-DigestWeekday+7)%7))
+	}
+	if start.After(now) {
+		if m.Digest == DigestWeekly {
+			start = start.AddDate(0, 0, -7)
+		} else {
+			start = start.AddDate(0, 0, -1)
+		}
+	}
+
+	return start
+}
+
+// Whether the member is due a digest at now (in their zone).
+func (m Member) DigestDue(now time.Time) bool {
+	if m.Digest != DigestDaily && m.Digest != DigestWeekly {
+		return false
+	}
+
+	return m.DigestSent.Before(m.DigestPeriod(now))
+}
+
+// Members who asked for a digest.
+func GetDigestMembers(c appengine.Context) []Member {
+	var dbResults []Member
+
+	q := datastore.NewQuery("Member").Filter("Digest >", "")
+	keys, err := q.GetAll(c, &dbResults)
+	if err != nil {
+		c.Infof("GetDigestMembers DB lookup error: %v", err)
+	}
+
+	for indx := range dbResults {
+		dbResults[indx].Key = keys[indx].Encode()
+	}
+
+	return dbResults
+}
+
+// Upcoming events of the member's organizations, soonest first, leaving
+// out those they unsubscribed from by email.
+func (m Member) UpcomingEvents(c appengine.Context, clock Clock) []Event {
+	var result []Event
+	var seen = make(map[string]bool)
+
+	for _, orgname := range m.Orgs {
+		if m.OptedOut(orgname, "email") {
+			continue
+		}
+
+		o, oerr := GetOrganizationByName(c, orgname)
+		if oerr != nil {
+			c.Infof("UpcomingEvents: Error looking up org: %s.", orgname)
+			continue
+		}
+
+		for key, event := range o.GetEvents(c, clock, true) {
+			if seen[key] || event.Due.Before(clock.Now()) {
+				continue
+			}
+			seen[key] = true
+			event.Key = key
+			result = append(result, event)
+		}
+	}
+
+	sort.Sort(EventsByDue(result))
+	return result
+}
+
+type EventsByDue []Event
+
+func (slice EventsByDue) Len() int           { return len(slice) }
+func (slice EventsByDue) Less(i, j int) bool { return slice[i].Due.Before(slice[j].Due) }
+func (slice EventsByDue) Swap(i, j int)      { slice[i], slice[j] = slice[j], slice[i] }
+
+// Email members their digest when it is due.
+func SendDigests(c appengine.Context, clock Clock, dryrun bool) (reminders Reminders) {
+	for _, m := range GetDigestMembers(c) {
+		var location = m.Location(c)
+		var now = clock.Now().In(location)
+		if m.DigestDue(now) == false || m.Email == "" || m.EmailOn == false {
+			continue
+		}
+
+		events := m.UpcomingEvents(c, clock)
+		if len(events) > 0 {
+			if dryrun {
+				c.Infof("dry run, not sending digest: %v", m.Email)
+			} else {
+				c.Infof("digest (%d events): %v", len(events), m.Email)
+				if err := mail.Send(c, DigestMessage(c, m, events, now)); err != nil {
+					c.Errorf("Couldn't send email: %v", err)
+					continue
+				}
+			}
+
+			reminders = append(reminders, Reminder{
+				Title:         strings.Title(m.Digest) + " digest",
+				Org:           strings.Join(m.Orgs, ", "),
+				Offset:        "digest",
+				Channel:       "email",
+				When:          now.Truncate(time.Minute),
+				WhenFormatted: now.Format("01/02/2006 3:04pm"),
+				Recipients:    []string{m.Email},
+			})
+		}
+
+		// Empty digests are skipped, but count as sent
+		if dryrun == false {
+			m.DigestSent = now.UTC()
+			m.Update(c, m.Key)
+		}
+	}
+
+	return
+}
+
+// The digest email listing events for m, with due times in the zone of
+// now.
+func DigestMessage(c appengine.Context, m Member, events []Event, now time.Time) *mail.Message {
+	var text, body bytes.Buffer
+	var appid = appengine.AppID(c)
+	var unsubscribe = UnsubscribeLink(c, m.Key, "", "email")
+
+	fmt.Fprintf(&text, "Upcoming events for %s:\n", m.Name)
+	fmt.Fprintf(&body, "<p>Upcoming events for %s:</p><ul>", html.EscapeString(m.Name))
+	for _, e := range events {
+		var due = e.Due.In(now.Location()).Format("Mon 01/02/2006 3:04pm MST")
+		var left = Remaining(e.Due.Sub(now))
+		var link = MessageLink(c, e.Key, m.Key)
+		var orgs = strings.Join(e.Orgs, ", ")
+
+		fmt.Fprintf(&text, "\n%s\nDue: %s (%s)\nFor: %s\n%s\n", e.Title, due, left, orgs, link)
+		fmt.Fprintf(&body, `<li><a href="%s">%s</a><br>Due: %s (%s)<br>For: %s</li>`,
+			html.EscapeString(link), html.EscapeString(e.Title), html.EscapeString(due), html.EscapeString(left), html.EscapeString(orgs))
+	}
+	body.WriteString("</ul>")
+	fmt.Fprintf(&text, "\nStop email reminders: %s\n", unsubscribe)
+	fmt.Fprintf(&body, `<p><small><a href="%s">Stop email reminders</a></small></p>`, html.EscapeString(unsubscribe))
+
+	return &mail.Message{
+		Sender:   "OrgReminders <orgreminders@" + appid + ".appspotmail.com>",
+		To:       []string{m.Email},
+		Subject:  fmt.Sprintf("Your %s reminder digest: %d upcoming", m.Digest, len(events)),
+		Body:     text.String(),
+		HTMLBody: body.String(),
+		Headers:  UnsubscribeHeaders(unsubscribe),
+	}
+}
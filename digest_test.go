@@ -0,0 +1,67 @@
+package orgreminders
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDigesting(t *testing.T) {
+	var tests = []struct {
+		name   string
+		member Member
+		event  Event
+		want   bool
+	}{
+		{"no digest", Member{Email: "a@example.com", EmailOn: true, Orgs: []string{"Ops"}}, Event{Orgs: []string{"Ops"}}, false},
+		{"digest", Member{Email: "a@example.com", EmailOn: true, Orgs: []string{"Ops"}, Digest: DigestDaily}, Event{Orgs: []string{"Ops"}}, true},
+		{"urgent", Member{Email: "a@example.com", EmailOn: true, Orgs: []string{"Ops"}, Digest: DigestDaily}, Event{Orgs: []string{"Ops"}, Urgent: true}, false},
+		{"email off", Member{Email: "a@example.com", TextOn: true, Orgs: []string{"Ops"}, Digest: DigestWeekly}, Event{Orgs: []string{"Ops"}}, false},
+		{"no address", Member{EmailOn: true, Orgs: []string{"Ops"}, Digest: DigestWeekly}, Event{Orgs: []string{"Ops"}}, false},
+		{"unsubscribed from org", Member{Email: "a@example.com", EmailOn: true, Orgs: []string{"Ops"}, Digest: DigestDaily, Unsubscribed: []string{"Ops/email"}}, Event{Orgs: []string{"Ops"}}, false},
+		{"unsubscribed from one org", Member{Email: "a@example.com", EmailOn: true, Orgs: []string{"Ops", "Dev"}, Digest: DigestDaily, Unsubscribed: []string{"Ops/email"}}, Event{Orgs: []string{"Ops", "Dev"}}, true},
+	}
+
+	for _, test := range tests {
+		if got := test.member.Digesting(test.event); got != test.want {
+			t.Errorf("%s: Digesting = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestValidateDigestNeedsEmail(t *testing.T) {
+	m := Member{Name: "Ann", Email: "a@example.com", Cell: "5555555555", TextAddr: "txt.example.com", TextOn: true, Orgs: []string{"Ops"}, Digest: DigestDaily}
+
+	if errs := m.Validate(); errs["digest"] == "" {
+		t.Errorf("digest with email off: no error, got %v", errs)
+	}
+
+	m.EmailOn = true
+	if errs := m.Validate(); len(errs) > 0 {
+		t.Errorf("digest with email on: %v", errs)
+	}
+}
+
+func TestDigestPeriod(t *testing.T) {
+	chicago, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Skip("no time zone data")
+	}
+
+	var tests = []struct {
+		digest string
+		now    time.Time
+		want   time.Time
+	}{
+		{DigestDaily, time.Date(2014, 3, 12, 9, 0, 0, 0, chicago), time.Date(2014, 3, 12, 7, 0, 0, 0, chicago)},
+		{DigestDaily, time.Date(2014, 3, 12, 6, 59, 0, 0, chicago), time.Date(2014, 3, 11, 7, 0, 0, 0, chicago)},
+		{DigestWeekly, time.Date(2014, 3, 12, 9, 0, 0, 0, chicago), time.Date(2014, 3, 10, 7, 0, 0, 0, chicago)},
+		{DigestWeekly, time.Date(2014, 3, 10, 6, 0, 0, 0, chicago), time.Date(2014, 3, 3, 7, 0, 0, 0, chicago)},
+	}
+
+	for _, test := range tests {
+		m := Member{Digest: test.digest}
+		if got := m.DigestPeriod(test.now); !got.Equal(test.want) {
+			t.Errorf("%s DigestPeriod(%v) = %v, want %v", test.digest, test.now, got, test.want)
+		}
+	}
+}
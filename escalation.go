@@ -0,0 +1,178 @@
+package orgreminders
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"fmt"
+	"time"
+)
+
+// Escalation tiers, in the order they are notified.
+const (
+	TierMembers = iota
+	TierBackups
+	TierAdmins
+)
+
+// Escalation state of an event, keyed by the event's key.
+type Escalation struct {
+	Event    string
+	Title    string
+	Reminded time.Time
+	Tier     int
+	Done     bool
+	Status   string
+	History  []string
+}
+
+func escalationKey(c appengine.Context, eventKey string) *datastore.Key {
+	return datastore.NewKey(c, "Escalation", eventKey, 0, nil)
+}
+
+// Retrieve an event's escalation state, if it has any.
+func GetEscalation(c appengine.Context, eventKey string) (bool, Escalation) {
+	var result Escalation
+
+	err := datastore.Get(c, escalationKey(c, eventKey), &result)
+	if err != nil {
+		if err != datastore.ErrNoSuchEntity {
+			c.Infof("GetEscalation DB lookup error: %v", err)
+		}
+		return false, result
+	}
+
+	return true, result
+}
+
+func (s Escalation) Save(c appengine.Context) bool {
+	_, err := datastore.Put(c, escalationKey(c, s.Event), &s)
+	if err != nil {
+		c.Errorf("Escalation.Save error: %v", err)
+		return false
+	}
+
+	return true
+}
+
+// Add an entry to the escalation history, timestamped in the event's zone.
+func (s *Escalation) Log(when time.Time, format string, args ...interface{}) {
+	var entry = when.Format("01/02/2006 3:04pm") + ": " + fmt.Sprintf(format, args...)
+	s.History = append(s.History, entry)
+	s.Status = fmt.Sprintf(format, args...)
+}
+
+// Whether a reminder that reached the given recipients, all of them still
+// owing an acknowledgement, (re)starts the event's escalation.
+func (e Event) Escalates(reached []string) bool {
+	return e.EscalateAfter > 0 && len(reached) > 0
+}
+
+// (Re)start the escalation clock after a reminder went out to the members.
+func StartEscalation(c appengine.Context, e Event, clock Clock) {
+	_, esc := GetEscalation(c, e.Key)
+	esc.Event = e.Key
+	esc.Title = e.Title
+	esc.Reminded = clock.Now().UTC()
+	esc.Tier = TierMembers
+	esc.Done = false
+	esc.Log(clock.Now().In(e.Location(c)), "reminder sent, waiting %d minutes for an acknowledgement", e.EscalateAfter)
+	esc.Save(c)
+}
+
+// Escalations still waiting for an acknowledgement.
+func GetOpenEscalations(c appengine.Context) (dbResults []Escalation) {
+	q := datastore.NewQuery("Escalation").Filter("Done = ", false)
+	_, err := q.GetAll(c, &dbResults)
+	if err != nil {
+		c.Infof("GetOpenEscalations DB lookup error: %v", err)
+	}
+
+	return
+}
+
+// Move unacknowledged events up to the next tier once their wait is over:
+// first the event's backup members, then the administrators of its orgs.
+func CheckEscalations(c appengine.Context, clock Clock, dryrun bool) (reminders Reminders) {
+	for _, esc := range GetOpenEscalations(c) {
+		okay, event := GetEventByKey(c, esc.Event)
+		if okay != true {
+			c.Infof("CheckEscalations: Error querying for event %s", esc.Event)
+			continue
+		}
+
+		var now = clock.Now().In(event.Location(c))
+		// Acks left over from an earlier occurrence do not count
+		var acked = AckedMembersSince(c, event.Key, esc.Reminded)
+		if len(acked) > 0 {
+			for memberKey := range acked {
+				_, member := GetMemberByKey(c, memberKey)
+				esc.Log(now, "acknowledged by %s", member.Name)
+				break
+			}
+			esc.Done = true
+		} else {
+			var wait = time.Duration(event.EscalateAfter) * time.Minute
+			if event.EscalateAfter <= 0 || now.Before(esc.Reminded.Add(wait*time.Duration(esc.Tier+1))) {
+				continue
+			}
+
+			esc.Tier++
+			if esc.Tier == TierBackups && len(event.Backups) == 0 {
+				esc.Tier = TierAdmins
+			}
+
+			switch esc.Tier {
+			case TierBackups:
+				var names []string
+				for _, memberKey := range event.Backups {
+					mok, member := GetMemberByKey(c, memberKey)
+					if mok == false {
+						continue
+					}
+					sent := event.NotifyMember(c, clock, member, "escalation", dryrun)
+					if len(sent) == 0 {
+						continue
+					}
+					names = append(names, member.Name)
+					reminders = append(reminders, sent...)
+				}
+				esc.Log(now, "no acknowledgement, notified backups %v", names)
+			case TierAdmins:
+				var admins []string
+				for _, orgname := range event.Orgs {
+					o, oerr := GetOrganizationByName(c, orgname)
+					if oerr != nil {
+						continue
+					}
+					admins = append(admins, o.Administrator...)
+				}
+				admins = removeDuplicates(admins)
+				for _, admin := range admins {
+					if dryrun == false {
+						AdminNotify(c, admin, "Unacknowledged: "+event.Title, "Nobody has acknowledged the following event: <br><br>"+event.GetHTMLView(c))
+					}
+				}
+				reminders = append(reminders, Reminder{
+					EventKey:      event.Key,
+					Title:         event.Title,
+					Org:           event.Orgs[0],
+					Offset:        "escalation",
+					Channel:       "email",
+					When:          now.Truncate(time.Minute),
+					WhenFormatted: now.Format("01/02/2006 3:04pm"),
+					Recipients:    admins,
+				})
+				esc.Log(now, "no acknowledgement, notified administrators %v", admins)
+			default:
+				esc.Log(now, "no acknowledgement, escalation exhausted")
+				esc.Done = true
+			}
+		}
+
+		if dryrun == false {
+			esc.Save(c)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,60 @@
+package orgreminders
+
+import "testing"
+
+func TestEscalatesOnlyForUnacknowledged(t *testing.T) {
+	var ann = Recipient{Member: Member{Key: "ann", Name: "Ann"}, Address: "ann@example.com"}
+	var bob = Recipient{Member: Member{Key: "bob", Name: "Bob"}, Address: "bob@example.com"}
+	var e = Event{EscalateAfter: 30}
+
+	var addresses = func(rcpts []Recipient) (result []string) {
+		for _, rcpt := range rcpts {
+			result = append(result, rcpt.Address)
+		}
+		return
+	}
+
+	// First reminder, nobody has acknowledged yet
+	var acked = map[string]bool{}
+	if reached := addresses(Unacknowledged([]Recipient{ann}, acked)); !e.Escalates(reached) {
+		t.Errorf("first reminder reached %v: no escalation, want one", reached)
+	}
+
+	// Acked before the second reminder, which then reaches nobody
+	acked["ann"] = true
+	if reached := addresses(Unacknowledged([]Recipient{ann}, acked)); len(reached) != 0 || e.Escalates(reached) {
+		t.Errorf("second reminder after the ack reached %v and escalates %v, want nobody and no escalation", reached, e.Escalates(reached))
+	}
+
+	// Others who still owe an ack keep it going
+	if reached := addresses(Unacknowledged([]Recipient{ann, bob}, acked)); len(reached) != 1 || !e.Escalates(reached) {
+		t.Errorf("reminder reached %v: want bob and an escalation", reached)
+	}
+
+	e.EscalateAfter = 0
+	if e.Escalates([]string{"bob@example.com"}) {
+		t.Errorf("event without escalation escalates")
+	}
+}
+
+func TestValidateBackups(t *testing.T) {
+	var e = Event{Orgs: []string{"Ops"}, Backups: []string{"ann", "bob"}}
+	var backups = map[string]Member{
+		"ann": {Key: "ann", Name: "Ann", Orgs: []string{"Dev", "Ops"}},
+		"bob": {Key: "bob", Name: "Bob", Orgs: []string{"Ops"}},
+	}
+
+	if errs := e.ValidateBackups(backups); len(errs) > 0 {
+		t.Errorf("backups in the event's orgs: %v", errs)
+	}
+
+	backups["bob"] = Member{Key: "bob", Name: "Bob", Orgs: []string{"Dev"}}
+	if msg := e.ValidateBackups(backups)["backups"]; msg == "" {
+		t.Errorf("backup outside the event's orgs: no error")
+	}
+
+	delete(backups, "bob")
+	if msg := e.ValidateBackups(backups)["backups"]; msg == "" {
+		t.Errorf("deleted backup: no error")
+	}
+}
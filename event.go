@@ -6,6 +6,7 @@ import (
 	"appengine/user"
 	"bytes"
 	"html/template"
+	"strings"
 	"time"
 )
 
@@ -16,13 +17,23 @@ type Event struct {
 	Saved        time.Time
 	Due          time.Time
 	DueFormatted string
+	TimeZone     string
 	Title        string
 	EmailMessage template.HTML
 	TextMessage  string
 	Submitter    user.User
 	Email        bool
 	Text         bool
+	Urgent       bool
 	Reminders    Schedule
+	// Minutes to wait for an acknowledgement before escalating (0 = never)
+	EscalateAfter int
+	// Member keys notified on the first escalation tier
+	Backups []string
+	// Markdown source of the messages, when written in Markdown
+	Markdown string `datastore:",noindex"`
+	// Number of times the event was updated, for calendar entries
+	Sequence int
 }
 
 func NewEvent() Event {
@@ -33,15 +44,17 @@ func NewEvent() Event {
 	return event
 }
 
-func GetAllEvents(c appengine.Context, active bool) map[string]Event {
+func GetAllEvents(c appengine.Context, clock Clock, active bool) map[string]Event {
 	var dbResults []Event
 	utcLoc, _ := time.LoadLocation("UTC")
-	var today = time.Date(time.Now().Year(), time.Now().Month(), time.Now().Day(), 0, 0, 0, 0, utcLoc)
+	var now = clock.Now()
+	var today = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, utcLoc)
 	mapResults := make(map[string]Event)
 	q := datastore.NewQuery("Event").Project("Orgs", "Due", "Email", "Text", "Title")
 
+	// Recently overdue events stay active for their follow-up reminders
 	if active {
-		q = q.Filter("Due >= ", today)
+		q = q.Filter("Due >= ", today.Add(-FollowUpWindow))
 	}
 
 	keys, err := q.GetAll(c, &dbResults)
@@ -75,10 +88,54 @@ func GetEventByKey(c appengine.Context, key string) (bool, Event) {
 		okay = true
 	}
 
+	// Stored before sanitizing existed, or written around the editor
+	result.EmailMessage = SanitizeHTML(string(result.EmailMessage))
+
 	result.Key = key
 	return okay, *result
 }
 
+// Full events for keys, fetched in one batch. Keys that are invalid or
+// no longer exist are left out.
+func GetEventsByKey(c appengine.Context, keys []string) map[string]Event {
+	var result = make(map[string]Event)
+	var keyObjs []*datastore.Key
+	var found []string
+
+	for _, key := range keys {
+		keyObj, decerr := datastore.DecodeKey(key)
+		if decerr != nil {
+			c.Infof("Invalid event key specified: %s", key)
+			continue
+		}
+		keyObjs = append(keyObjs, keyObj)
+		found = append(found, key)
+	}
+	if len(keyObjs) == 0 {
+		return result
+	}
+
+	var events = make([]Event, len(keyObjs))
+	err := datastore.GetMulti(c, keyObjs, events)
+	errs, multi := err.(appengine.MultiError)
+	if err != nil && multi == false {
+		c.Infof("GetEventsByKey DB lookup error: %v", err)
+		return result
+	}
+
+	for indx, event := range events {
+		if multi && errs[indx] != nil {
+			c.Infof("GetEventsByKey DB lookup error for %s: %v", found[indx], errs[indx])
+			continue
+		}
+		event.EmailMessage = SanitizeHTML(string(event.EmailMessage))
+		event.Key = found[indx]
+		result[event.Key] = event
+	}
+
+	return result
+}
+
 // Save an event to the database
 func (e Event) Save(c appengine.Context) (bool, string) {
 	var result bool
@@ -87,13 +144,46 @@ func (e Event) Save(c appengine.Context) (bool, string) {
 	key := datastore.NewIncompleteKey(c, "Event", nil)
 	keyNew, err := datastore.Put(c, key, &e)
 	if err != nil {
-		result = false
+		c.Infof("event.Save error: %v", err)
+		return result, ""
 	}
 
+	result = true
 	return result, keyNew.Encode()
 }
 
-func (e Event) Update(c appengine.Context) bool {
+// Delete an event along with its acknowledgements, snoozes, deferred
+// reminders and escalation, so the cron job has nothing left to send, and
+// the link from any external ID that created it.
+func DeleteEvent(c appengine.Context, key string) bool {
+	keyObj, decerr := datastore.DecodeKey(key)
+	if decerr != nil {
+		c.Infof("Invalid key specified")
+		return false
+	}
+
+	keys := []*datastore.Key{keyObj, escalationKey(c, key)}
+	for _, kind := range []string{"Ack", "Deferral", "ExternalEvent"} {
+		related, err := datastore.NewQuery(kind).Filter("Event = ", key).KeysOnly().GetAll(c, nil)
+		if err != nil {
+			c.Infof("DeleteEvent %s lookup error: %v", kind, err)
+			return false
+		}
+		keys = append(keys, related...)
+	}
+
+	if err := datastore.DeleteMulti(c, keys); err != nil {
+		c.Infof("DeleteEvent error: %v", err)
+		return false
+	}
+
+	return true
+}
+
+// Update a stored event. Edits are built from the form, so the original
+// creation time is kept and the sequence goes up by one. Events stored
+// under a reserved key for the first time start at sequence 0.
+func (e *Event) Update(c appengine.Context) bool {
 	var result bool
 
 	keyObj, decerr := datastore.DecodeKey(e.Key)
@@ -102,21 +192,130 @@ func (e Event) Update(c appengine.Context) bool {
 		return result
 	}
 
-	e.Saved = time.Now().UTC()
-	_, err := datastore.Put(c, keyObj, &e)
+	err := datastore.RunInTransaction(c, func(tc appengine.Context) error {
+		var stored Event
+		err := datastore.Get(tc, keyObj, &stored)
+		if err == nil {
+			e.Created = stored.Created
+			e.Sequence = stored.Sequence + 1
+		} else if err != datastore.ErrNoSuchEntity {
+			return err
+		}
+
+		e.Saved = time.Now().UTC()
+		_, err = datastore.Put(tc, keyObj, e)
+		return err
+	}, nil)
 	if err != nil {
-		result = false
+		c.Infof("event.Update error: %v", err)
+	} else {
+		result = true
 	}
 
 	return result
 }
 
-func (e Event) Notify(c appengine.Context, now bool) (sent bool) {
-	// Loop through organizations for the event and send out notifications
+// Fill in the event's time zone, defaulting to that of its first
+// organization, and its due date as typed (read in that zone), then check
+// it. Shared by the event editor and the inbound webhook.
+func (e *Event) Prepare(c appengine.Context, clock Clock, due string) FieldErrors {
+	var errs = FieldErrors{}
+	var orgs []Organization
+
+	for indx, orgname := range e.Orgs {
+		o, err := GetOrganizationByName(c, orgname)
+		if err != nil {
+			c.Infof("Error: %s", err.Error())
+			errs.Add("orgs", err.Error())
+			continue
+		}
+		if indx == 0 && e.TimeZone == "" {
+			e.TimeZone = o.TimeZone
+		}
+		orgs = append(orgs, o)
+	}
+
+	location := time.UTC
+	if ValidTimeZone(e.TimeZone) {
+		location, _ = time.LoadLocation(e.TimeZone)
+	}
+
+	now := clock.Now().In(location)
+	t, timeerr := ParseDue(due, now)
+	if timeerr != nil {
+		errs.Add("due", timeerr.Error())
+	}
+	e.Due = t
+	errs.Merge(e.Validate(now))
+	errs.Merge(e.ValidateFollowUps(orgs, now))
+
+	var backups = make(map[string]Member)
+	for _, key := range e.Backups {
+		if ok, member := GetMemberByKey(c, key); ok {
+			backups[key] = member
+		}
+	}
+	errs.Merge(e.ValidateBackups(backups))
+
+	return errs
+}
+
+// Save a new event (created) or update an existing one, and let the
+// organizations' webhooks know. New events that already have a key, one
+// reserved for them, are stored under it.
+func (e *Event) Store(c appengine.Context, clock Clock, created bool) (saved bool) {
+	if e.Key == "" {
+		saved, e.Key = e.Save(c)
+	} else {
+		saved = e.Update(c)
+	}
+
+	if saved == false {
+		return
+	}
+
+	if created {
+		FireEventWebhook(c, clock, HookEventCreated, *e)
+	} else {
+		FireEventWebhook(c, clock, HookEventUpdated, *e)
+	}
+
+	return
+}
+
+// Send out any reminders due at the clock's current minute (or all of them
+// when now is set). With dryrun set nothing is handed to mail.Send; the
+// returned reminders describe what was (or would have been) sent.
+func (e Event) Notify(c appengine.Context, clock Clock, now bool, dryrun bool) (sent bool, reminders Reminders) {
+	var notifyOrgs []Organization
+	var orgNames []string
+	var offset string
+
+	// Follow-ups never reach past FollowUpWindow, so long overdue events
+	// can be skipped without loading them
+	if e.Due.Add(FollowUpWindow).Before(clock.Now()) {
+		return false, reminders
+	}
+
+	// Get full Event data
+	okay, fullevent := GetEventByKey(c, e.Key)
+	if okay != true {
+		c.Infof("Event.Notify: Error querying for event %s", e.Key)
+		return false, reminders
+	}
+
+	// All reminder math happens in the event's own time zone
+	location := fullevent.Location(c)
+	checkTime := clock.Now().In(location)
+	var due = fullevent.Due.In(location)
+
+	// Loop through organizations for the event and collect the ones due
+	// a reminder this minute
 	//c.Infof("# orgs for event: %v", len(e.Orgs))
 	for _, orgname := range e.Orgs {
 		//c.Infof("event org: %s", orgname)
 		var notify bool
+		var orgOffset string
 		// Lookup organization
 		o, oerr := GetOrganizationByName(c, orgname)
 		if oerr != nil {
@@ -124,62 +323,225 @@ func (e Event) Notify(c appengine.Context, now bool) (sent bool) {
 			continue
 		}
 
-		// Analyze the active event and see if we need to send out a notification
-		location, _ := time.LoadLocation(o.TimeZone)
-		checkTime := time.Now().In(location)
-
-		// If we are overdue, don't notify
-		if e.Due.In(location).Unix() < time.Now().In(location).Unix() {
-			c.Infof("event is past due: %v", e.Due.In(location))
+		// If we are overdue (and past any follow-ups), don't notify
+		if due.Add(fullevent.Reminders.FollowUp(due, o.Calendar())).Unix() < checkTime.Unix() {
+			c.Infof("event is past due: %v", due)
 			continue
 		}
 
-		// Get full Event data
-		okay, fullevent := GetEventByKey(c, e.Key)
-		if okay != true {
-			c.Infof("Event.Notify: Error querying for event %s", e.Key)
-			return false
-		}
-
 		if now {
 			notify = true
+			orgOffset = "now"
 		} else {
 			// Cycle through event reminder times and notify (or not)
-			var times = fullevent.Reminders.Times(fullevent.Due.In(location))
+			var times = fullevent.Reminders.Times(due, o.Calendar())
 			//c.Infof("event times: %v", times)
 			//c.Infof("event sched: %v", fullevent.Reminders)
-			for _, ttime := range times {
+			for toffset, ttime := range times {
 				var curminute = checkTime.Truncate(time.Minute)
 				var eventminute = ttime.Truncate(time.Minute)
 				//c.Infof("cur minute: %v", curminute)
 				//c.Infof("event minute: %v", eventminute)
 				if curminute == eventminute {
 					notify = true
+					orgOffset = toffset
 					break
 				}
 			}
 		}
 
-		// Trigger notification
 		if notify {
-			c.Infof("Event notification triggered")
-			if e.Email {
-				sent = SendOrgMessage(c, o, fullevent, "email")
+			if offset == "" {
+				offset = orgOffset
 			}
-			if e.Text {
-				sent = SendOrgMessage(c, o, fullevent, "text")
+			notifyOrgs = append(notifyOrgs, o)
+			orgNames = append(orgNames, o.Name)
+		}
+	}
+
+	if len(notifyOrgs) == 0 {
+		return
+	}
+
+	// Trigger notification, once per person across all the orgs
+	c.Infof("Event notification triggered")
+	var reached []string
+	for _, channel := range e.Channels() {
+		var recipients []string
+		var deferred Reminders
+		sent, recipients, deferred = SendEventMessage(c, clock, notifyOrgs, fullevent, channel, dryrun)
+		reached = append(reached, recipients...)
+		reminder := Reminder{
+			EventKey:      fullevent.Key,
+			Title:         fullevent.Title,
+			Org:           strings.Join(orgNames, ", "),
+			Offset:        offset,
+			Channel:       channel,
+			When:          checkTime.Truncate(time.Minute),
+			WhenFormatted: checkTime.Format("01/02/2006 3:04pm"),
+			Recipients:    recipients,
+		}
+		reminders = append(reminders, reminder)
+		if dryrun == false && len(recipients) > 0 {
+			FireReminderWebhook(c, clock, orgNames, reminder, sent)
+		}
+
+		// Dry runs also show what quiet hours hold back, as it will go out
+		if dryrun {
+			reminders = append(reminders, deferred...)
+		}
+	}
+
+	// Only members who have not acknowledged yet restart the escalation
+	if fullevent.Escalates(reached) && dryrun == false {
+		StartEscalation(c, fullevent, clock)
+	}
+
+	// Chat webhooks get one post per event, not one per member
+	if chatsent, hooks := SendChatMessage(c, clock, notifyOrgs, fullevent, dryrun); len(hooks) > 0 {
+		sent = sent && chatsent
+		reminder := Reminder{
+			EventKey:      fullevent.Key,
+			Title:         fullevent.Title,
+			Org:           strings.Join(orgNames, ", "),
+			Offset:        offset,
+			Channel:       "chat",
+			When:          checkTime.Truncate(time.Minute),
+			WhenFormatted: checkTime.Format("01/02/2006 3:04pm"),
+			Recipients:    hooks,
+		}
+		reminders = append(reminders, reminder)
+		if dryrun == false {
+			FireReminderWebhook(c, clock, orgNames, reminder, chatsent)
+		}
+	}
+
+	return
+}
+
+// Send the event straight to a single member, outside of its schedule.
+// The reason is recorded as the reminder's offset.
+func (e Event) NotifyMember(c appengine.Context, clock Clock, m Member, reason string, dryrun bool) (reminders Reminders) {
+	for _, orgname := range e.Orgs {
+		var member bool
+		for _, morg := range m.Orgs {
+			if morg == orgname {
+				member = true
+				break
 			}
 		}
+		if member == false {
+			continue
+		}
+
+		o, oerr := GetOrganizationByName(c, orgname)
+		if oerr != nil {
+			c.Infof("NotifyMember: Error looking up org: %s.", orgname)
+			continue
+		}
+
+		location := e.Location(c)
+		checkTime := clock.Now().In(location)
+		for _, channel := range e.Channels() {
+			var addr = m.OrgAddress(o.Name, channel)
+			if addr == "" {
+				continue
+			}
+
+			ok := SendReminder(c, clock, e, channel, Recipient{Member: m, Address: addr, Org: o}, dryrun)
+			reminder := Reminder{
+				EventKey:      e.Key,
+				Title:         e.Title,
+				Org:           o.Name,
+				Offset:        reason,
+				Channel:       channel,
+				When:          checkTime.Truncate(time.Minute),
+				WhenFormatted: checkTime.Format("01/02/2006 3:04pm"),
+				Recipients:    []string{addr},
+			}
+			reminders = append(reminders, reminder)
+			if dryrun == false {
+				FireReminderWebhook(c, clock, []string{o.Name}, reminder, ok)
+			}
+		}
+
+		// One organization is enough, the member only needs it once
+		break
 	}
 
 	return
 }
 
+// Time zone of the event, or that of o for events saved without one.
+// Unlike Location it needs no lookups.
+func (e Event) Zone(o Organization) *time.Location {
+	if ValidTimeZone(e.TimeZone) {
+		location, _ := time.LoadLocation(e.TimeZone)
+		return location
+	}
+
+	return o.Location()
+}
+
+// Time zone of the event. Events saved without one borrow the zone of
+// their first organization.
+func (e Event) Location(c appengine.Context) *time.Location {
+	if e.TimeZone != "" {
+		location, err := time.LoadLocation(e.TimeZone)
+		if err == nil {
+			return location
+		}
+		c.Infof("Event %s has an invalid time zone: %s", e.Key, e.TimeZone)
+	}
+
+	if len(e.Orgs) == 0 {
+		return time.UTC
+	}
+
+	o, _ := GetOrganizationByName(c, e.Orgs[0])
+	return o.Location()
+}
+
+// Write the event's messages in Markdown. The email body is rendered from
+// src; a blank text message is filled in from it when sending.
+func (e *Event) SetMarkdown(src string) {
+	e.Markdown = src
+	e.EmailMessage = SanitizeHTML(RenderMarkdown(src))
+}
+
+// Plain text part of the event's email. Markdown events use their source
+// rendered as text, HTML events a text version of their email message.
+// Events without an email message fall back to their text message.
+func (e Event) PlainBody() string {
+	if e.Markdown != "" {
+		return MarkdownText(e.Markdown)
+	}
+	if text := HTMLText(e.EmailMessage); text != "" {
+		return text
+	}
+
+	return e.TextMessage
+}
+
+// Delivery channels enabled for the event.
+func (e Event) Channels() []string {
+	var channels = []string{}
+
+	if e.Email {
+		channels = append(channels, "email")
+	}
+	if e.Text {
+		channels = append(channels, "text")
+	}
+
+	return channels
+}
+
 func (e Event) GetHTMLView(c appengine.Context) string {
 	buffer := new(bytes.Buffer)
 	var tmpltxt = `<label>Event Title: </label><a href="https://orgreminders.appspot.com/editevent?id={{.Key}}">{{.Title}}</a>
 	<br>
-	<label>When Due: </label>{{.DueFormatted}}
+	<label>When Due: </label>{{.DueFormatted}} {{.TimeZone}}
 	<br>
 	<label>Organization(s): </label>{{range .Orgs}}{{.}},{{end}}
 	<br>
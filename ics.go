@@ -0,0 +1,100 @@
+package orgreminders
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Layout of UTC date-times in iCalendar files.
+const ICSTimeLayout = "20060102T150405Z"
+
+// Length of the calendar entry starting at the due time, so that it
+// shows up as a block rather than a zero-length entry.
+const ICSDuration = "PT30M"
+
+// Calendar UID of an event. It only depends on the event's key, so every
+// reminder (and every edit of the due time) updates the same calendar
+// entry rather than adding another.
+func EventUID(c appengine.Context, e Event) string {
+	var id = e.Key
+	if key, err := datastore.DecodeKey(e.Key); err == nil && key.IntID() != 0 {
+		id = fmt.Sprintf("%d", key.IntID())
+	}
+
+	return fmt.Sprintf("event-%s@%s", id, appengine.DefaultVersionHostname(c))
+}
+
+// iCalendar (METHOD:PUBLISH) file holding e as a single calendar entry at
+// its due time, with description as its notes.
+func EventICS(c appengine.Context, e Event, description string, now time.Time) []byte {
+	return eventICS(e, EventUID(c, e), appengine.AppID(c), description, now)
+}
+
+func eventICS(e Event, uid string, appid string, description string, now time.Time) []byte {
+	var buf bytes.Buffer
+
+	// Calendars keep the entry with the highest sequence, which goes up
+	// with every update of the event
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//orgreminders//" + appid + "//EN",
+		"METHOD:PUBLISH",
+		"BEGIN:VEVENT",
+		"UID:" + uid,
+		"SEQUENCE:" + fmt.Sprintf("%d", e.Sequence),
+		"DTSTAMP:" + now.UTC().Format(ICSTimeLayout),
+		"DTSTART:" + e.Due.UTC().Format(ICSTimeLayout),
+		"DURATION:" + ICSDuration,
+		"SUMMARY:" + icsEscape(e.Title),
+		"DESCRIPTION:" + icsEscape(description),
+	}
+	if e.Saved.IsZero() == false {
+		lines = append(lines, "LAST-MODIFIED:"+e.Saved.UTC().Format(ICSTimeLayout))
+	}
+	lines = append(lines, "END:VEVENT", "END:VCALENDAR")
+
+	for _, line := range lines {
+		buf.WriteString(icsFold(line))
+	}
+
+	return buf.Bytes()
+}
+
+// Escape a TEXT value.
+func icsEscape(s string) string {
+	return strings.NewReplacer(
+		"\\", "\\\\",
+		";", "\\;",
+		",", "\\,",
+		"\r\n", "\\n",
+		"\n", "\\n",
+		"\r", "",
+	).Replace(s)
+}
+
+// Fold a content line into CRLF terminated lines of at most 75 octets,
+// without splitting characters.
+func icsFold(line string) string {
+	var buf bytes.Buffer
+	var width = 75
+
+	for len(line) > width {
+		cut := width
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		buf.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// The leading space of a continuation counts towards its length
+		width = 74
+	}
+	buf.WriteString(line + "\r\n")
+
+	return buf.String()
+}
@@ -0,0 +1,101 @@
+package orgreminders
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestICSEscape(t *testing.T) {
+	var tests = []struct {
+		in   string
+		want string
+	}{
+		{"Budget review", "Budget review"},
+		{"a, b; c", `a\, b\; c`},
+		{`C:\reports`, `C:\\reports`},
+		{"one\ntwo\r\nthree\r", `one\ntwo\nthree`},
+	}
+
+	for _, test := range tests {
+		if got := icsEscape(test.in); got != test.want {
+			t.Errorf("icsEscape(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestICSFold(t *testing.T) {
+	var tests = []struct {
+		name string
+		in   string
+	}{
+		{"short", "SUMMARY:Budget review"},
+		{"exactly 75", "DESCRIPTION:" + strings.Repeat("a", 63)},
+		{"long ascii", "DESCRIPTION:" + strings.Repeat("abcdefghij", 20)},
+		{"long multibyte", "DESCRIPTION:" + strings.Repeat("Genève ж 👍 ", 20)},
+	}
+
+	for _, test := range tests {
+		got := icsFold(test.in)
+		if !strings.HasSuffix(got, "\r\n") {
+			t.Errorf("%s: not CRLF terminated: %q", test.name, got)
+			continue
+		}
+
+		lines := strings.Split(strings.TrimSuffix(got, "\r\n"), "\r\n")
+		var unfolded string
+		for indx, line := range lines {
+			if len(line) > 75 {
+				t.Errorf("%s: line %d is %d octets: %q", test.name, indx+1, len(line), line)
+			}
+			if indx > 0 {
+				if !strings.HasPrefix(line, " ") {
+					t.Errorf("%s: continuation %d does not start with a space: %q", test.name, indx+1, line)
+				}
+				line = line[1:]
+			}
+			if !utf8.ValidString(line) {
+				t.Errorf("%s: line %d splits a character: %q", test.name, indx+1, line)
+			}
+			unfolded += line
+		}
+		if unfolded != test.in {
+			t.Errorf("%s: unfolds to %q, want %q", test.name, unfolded, test.in)
+		}
+		if len(test.in) <= 75 && len(lines) != 1 {
+			t.Errorf("%s: folded a line that fits: %q", test.name, got)
+		}
+	}
+}
+
+func TestEventICS(t *testing.T) {
+	var e = Event{
+		Title:    "Budget; Q1, Q2",
+		Due:      time.Date(2014, 3, 10, 14, 30, 0, 0, time.FixedZone("CDT", -5*3600)),
+		Saved:    time.Date(2014, 3, 1, 9, 0, 0, 0, time.UTC),
+		Sequence: 3,
+	}
+	var now = time.Date(2014, 3, 9, 8, 0, 0, 0, time.UTC)
+
+	got := string(eventICS(e, "event-42@example.com", "orgreminders", "Send your numbers\nby noon", now))
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"UID:event-42@example.com\r\n",
+		"SEQUENCE:3\r\n",
+		"DTSTAMP:20140309T080000Z\r\n",
+		"DTSTART:20140310T193000Z\r\n",
+		"DURATION:PT30M\r\n",
+		`SUMMARY:Budget\; Q1\, Q2` + "\r\n",
+		`DESCRIPTION:Send your numbers\nby noon` + "\r\n",
+		"LAST-MODIFIED:20140301T090000Z\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("EventICS missing %q in:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "DTEND") {
+		t.Errorf("EventICS has a DTEND as well as a DURATION:\n%s", got)
+	}
+}
@@ -0,0 +1,316 @@
+package orgreminders
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"appengine/user"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Largest request body the inbound webhook reads.
+const inboundMaxBody = 1 << 20
+
+// Secret external systems present to create events for an organization,
+// keyed by the organization's name.
+type InboundToken struct {
+	Org     string
+	Token   string `datastore:",noindex"`
+	Created time.Time
+}
+
+// Link from a client's external ID to the event it created, keyed by the
+// organization's name and the ID. Stored is set by the delivery that
+// creates the event.
+type ExternalEvent struct {
+	Event   string
+	Created time.Time
+	Stored  bool
+}
+
+// An event as posted to the inbound webhook. Due takes anything the event
+// editor does; schedule entries use the stored notation ("1d", "2h",
+// "+1d", "@2006-01-02 15:04"). Without channels the event goes by email.
+type InboundEvent struct {
+	ExternalID   string   `json:"external_id"`
+	Title        string   `json:"title"`
+	Due          string   `json:"due"`
+	TimeZone     string   `json:"timezone"`
+	EmailMessage string   `json:"email_message"`
+	Markdown     string   `json:"markdown"`
+	TextMessage  string   `json:"text_message"`
+	Schedule     []string `json:"schedule"`
+	Channels     []string `json:"channels"`
+	Urgent       bool     `json:"urgent"`
+}
+
+func inboundTokenKey(c appengine.Context, org string) *datastore.Key {
+	return datastore.NewKey(c, "InboundToken", org, 0, nil)
+}
+
+func externalEventKey(c appengine.Context, org string, id string) *datastore.Key {
+	return datastore.NewKey(c, "ExternalEvent", org+"/"+id, 0, nil)
+}
+
+// Retrieve an organization's inbound token, if it has one.
+func GetInboundToken(c appengine.Context, org string) (bool, InboundToken) {
+	var result InboundToken
+
+	err := datastore.Get(c, inboundTokenKey(c, org), &result)
+	if err != nil {
+		if err != datastore.ErrNoSuchEntity {
+			c.Infof("GetInboundToken DB lookup error: %v", err)
+		}
+		return false, result
+	}
+
+	return true, result
+}
+
+// Give an organization a new inbound token, replacing any old one.
+func NewInboundToken(c appengine.Context, org string) (bool, InboundToken) {
+	var result = InboundToken{Org: org, Created: time.Now().UTC()}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		c.Errorf("NewInboundToken error: %v", err)
+		return false, result
+	}
+	result.Token = hex.EncodeToString(secret)
+
+	if _, err := datastore.Put(c, inboundTokenKey(c, org), &result); err != nil {
+		c.Errorf("NewInboundToken error: %v", err)
+		return false, result
+	}
+
+	return true, result
+}
+
+// Whether an Authorization header ("Bearer <token>") carries the token.
+func (t InboundToken) Authorizes(header string) bool {
+	var token = strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+
+	return token != "" && t.Token != "" && hmac.Equal([]byte(token), []byte(t.Token))
+}
+
+// Copy the posted fields onto e.
+func (in InboundEvent) Apply(e *Event) FieldErrors {
+	var errs = FieldErrors{}
+
+	e.Title = in.Title
+	e.TextMessage = in.TextMessage
+	e.Urgent = in.Urgent
+	if in.TimeZone != "" {
+		e.TimeZone = in.TimeZone
+	}
+
+	if in.Markdown != "" {
+		e.SetMarkdown(in.Markdown)
+	} else {
+		e.Markdown = ""
+		e.EmailMessage = SanitizeHTML(in.EmailMessage)
+	}
+
+	e.Reminders.When = nil
+	for _, entry := range in.Schedule {
+		e.Reminders.Add(strings.TrimSpace(entry))
+	}
+
+	e.Email, e.Text = len(in.Channels) == 0, false
+	for _, channel := range in.Channels {
+		switch channel {
+		case "email":
+			e.Email = true
+		case "text":
+			e.Text = true
+		default:
+			errs.Add("channels", "Unknown channel "+channel+", expected email or text.")
+		}
+	}
+
+	return errs
+}
+
+// Create or update an event for the organization at /inbound/<org key>
+// from a JSON InboundEvent. The caller authenticates with
+// "Authorization: Bearer <token>". Posting the same external ID again
+// updates the event it created.
+func InboundHandler(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+
+	if r.Method != "POST" {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "POST a JSON event"})
+		return
+	}
+
+	o := GetOrganizationByKey(c, strings.TrimPrefix(r.URL.Path, "/inbound/"))
+	if o.Name == "" {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown organization"})
+		return
+	}
+
+	okay, stored := GetInboundToken(c, o.Name)
+	if okay == false || stored.Authorizes(r.Header.Get("Authorization")) == false {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid token"})
+		return
+	}
+
+	var in InboundEvent
+	if err := json.NewDecoder(io.LimitReader(r.Body, inboundMaxBody)).Decode(&in); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON: " + err.Error()})
+		return
+	}
+
+	// Redeliveries update the event created the first time
+	event := NewEvent()
+	event.Orgs = []string{o.Name}
+	event.Submitter = user.User{Email: "inbound@" + o.Name}
+	if in.ExternalID != "" {
+		key, err := reserveExternalEvent(c, o.Name, in.ExternalID)
+		if err != nil {
+			c.Errorf("InboundHandler: Couldn't record external ID %s: %v", in.ExternalID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "unable to record the external ID"})
+			return
+		}
+		if found, existing := GetEventByKey(c, key); found {
+			event = existing
+		} else {
+			event.Key = key
+		}
+	}
+
+	errs := in.Apply(&event)
+	errs.Merge(event.Prepare(c, SystemClock, in.Due))
+	if len(errs) > 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"errors": errs})
+		return
+	}
+
+	// Of several deliveries of a new external ID only one creates the event
+	created := true
+	if in.ExternalID != "" {
+		var err error
+		created, err = claimExternalEvent(c, o.Name, in.ExternalID)
+		if err != nil {
+			c.Errorf("InboundHandler: Couldn't claim external ID %s: %v", in.ExternalID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "unable to record the external ID"})
+			return
+		}
+	}
+
+	if event.Store(c, SystemClock, created) == false {
+		if created && in.ExternalID != "" {
+			releaseExternalEvent(c, o.Name, in.ExternalID)
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "unable to save the event"})
+		return
+	}
+
+	var subject = "Event Saved: "
+	status := http.StatusCreated
+	if created == false {
+		subject = "Event Updated: "
+		status = http.StatusOK
+	}
+
+	c.Infof("inbound event (%s) for %s, created: %v", event.Title, o.Name, created)
+	event.DueFormatted = event.Due.In(event.Location(c)).Format("01/02/2006 3:04pm")
+	for _, admin := range o.Administrator {
+		AdminNotify(c, admin, subject+event.Title, "The following event was just saved through the inbound webhook: <br><br>"+event.GetHTMLView(c))
+	}
+
+	writeJSON(w, status, map[string]interface{}{"key": event.Key, "created": created})
+}
+
+// Key of the event created for an external ID. The first time the ID is
+// seen a key is allocated and the link saved, in a transaction, before the
+// event exists. Retries and concurrent deliveries of the same ID all get
+// that key, so they cannot create a second event.
+func reserveExternalEvent(c appengine.Context, org string, id string) (string, error) {
+	var link ExternalEvent
+
+	low, _, err := datastore.AllocateIDs(c, "Event", nil, 1)
+	if err != nil {
+		return "", err
+	}
+
+	err = datastore.RunInTransaction(c, func(tc appengine.Context) error {
+		key := externalEventKey(tc, org, id)
+		if err := datastore.Get(tc, key, &link); err != datastore.ErrNoSuchEntity {
+			return err
+		}
+
+		link = ExternalEvent{Event: datastore.NewKey(tc, "Event", "", low, nil).Encode(), Created: time.Now().UTC()}
+		_, err := datastore.Put(tc, key, &link)
+		return err
+	}, nil)
+
+	return link.Event, err
+}
+
+// Mark the event reserved for an external ID as stored, in a transaction,
+// and report whether the caller is the one creating it. Links saved before
+// Stored existed count as stored once their event does.
+func claimExternalEvent(c appengine.Context, org string, id string) (created bool, err error) {
+	err = datastore.RunInTransaction(c, func(tc appengine.Context) error {
+		var link ExternalEvent
+		created = false
+
+		key := externalEventKey(tc, org, id)
+		if err := datastore.Get(tc, key, &link); err != nil {
+			return err
+		}
+		if link.Stored {
+			return nil
+		}
+
+		eventKey, err := datastore.DecodeKey(link.Event)
+		if err != nil {
+			return err
+		}
+		var existing Event
+		if err := datastore.Get(tc, eventKey, &existing); err == datastore.ErrNoSuchEntity {
+			created = true
+		} else if err != nil {
+			return err
+		}
+
+		link.Stored = true
+		_, err = datastore.Put(tc, key, &link)
+		return err
+	}, &datastore.TransactionOptions{XG: true})
+
+	return created, err
+}
+
+// Undo claimExternalEvent after the event could not be saved, so that a
+// retry creates it.
+func releaseExternalEvent(c appengine.Context, org string, id string) {
+	err := datastore.RunInTransaction(c, func(tc appengine.Context) error {
+		var link ExternalEvent
+
+		key := externalEventKey(tc, org, id)
+		if err := datastore.Get(tc, key, &link); err != nil {
+			return err
+		}
+
+		link.Stored = false
+		_, err := datastore.Put(tc, key, &link)
+		return err
+	}, nil)
+	if err != nil {
+		c.Errorf("releaseExternalEvent error: %v", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,94 @@
+package orgreminders
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInboundEventApply(t *testing.T) {
+	var tests = []struct {
+		name      string
+		in        InboundEvent
+		email     bool
+		text      bool
+		errs      bool
+		html      string
+		markdown  string
+		reminders []string
+	}{
+		{"default channel", InboundEvent{Title: "Report"}, true, false, false, "", "", nil},
+		{"email", InboundEvent{Channels: []string{"email"}}, true, false, false, "", "", nil},
+		{"text only", InboundEvent{Channels: []string{"text"}}, false, true, false, "", "", nil},
+		{"both", InboundEvent{Channels: []string{"text", "email"}}, true, true, false, "", "", nil},
+		{"unknown channel", InboundEvent{Channels: []string{"email", "fax"}}, true, false, true, "", "", nil},
+		{"html sanitized", InboundEvent{EmailMessage: `<p onclick="x()">Hi<script>alert(1)</script></p>`}, true, false, false, "<p>Hi</p>", "", nil},
+		{"markdown", InboundEvent{Markdown: "**Hi** <b>", EmailMessage: "<p>ignored</p>"}, true, false, false, "<p><strong>Hi</strong> &lt;b&gt;</p>", "**Hi** <b>", nil},
+		{"schedule", InboundEvent{Schedule: []string{" 1d", "2h ", "+1d", "@2014-03-10 09:00"}}, true, false, false, "", "", []string{"1d", "2h", "+1d", "@2014-03-10 09:00"}},
+	}
+
+	for _, test := range tests {
+		// Redeliveries replace what an earlier one set
+		var e = Event{
+			Email:        false,
+			Text:         true,
+			Markdown:     "old",
+			EmailMessage: "<p>old</p>",
+			Reminders:    Schedule{When: []string{"3d"}},
+		}
+
+		errs := test.in.Apply(&e)
+		if (len(errs) > 0) != test.errs {
+			t.Errorf("%s: errors %v, want errors %v", test.name, errs, test.errs)
+		}
+		if e.Email != test.email || e.Text != test.text {
+			t.Errorf("%s: email %v text %v, want %v %v", test.name, e.Email, e.Text, test.email, test.text)
+		}
+		if string(e.EmailMessage) != test.html || e.Markdown != test.markdown {
+			t.Errorf("%s: message %q markdown %q, want %q %q", test.name, e.EmailMessage, e.Markdown, test.html, test.markdown)
+		}
+		if !reflect.DeepEqual(e.Reminders.When, test.reminders) {
+			t.Errorf("%s: reminders %q, want %q", test.name, e.Reminders.When, test.reminders)
+		}
+	}
+}
+
+func TestInboundEventApplyKeepsTimeZone(t *testing.T) {
+	var e = Event{TimeZone: "America/Chicago"}
+
+	InboundEvent{}.Apply(&e)
+	if e.TimeZone != "America/Chicago" {
+		t.Errorf("no time zone posted: zone changed to %q", e.TimeZone)
+	}
+
+	InboundEvent{TimeZone: "Europe/London"}.Apply(&e)
+	if e.TimeZone != "Europe/London" {
+		t.Errorf("time zone posted: zone %q, want Europe/London", e.TimeZone)
+	}
+}
+
+func TestInboundTokenAuthorizes(t *testing.T) {
+	var token = InboundToken{Org: "Ops", Token: "0123456789abcdef"}
+
+	var tests = []struct {
+		header string
+		want   bool
+	}{
+		{"Bearer 0123456789abcdef", true},
+		{"Bearer  0123456789abcdef ", true},
+		{"0123456789abcdef", true},
+		{"Bearer 0123456789abcdeF", false},
+		{"Bearer 0123456789abcde", false},
+		{"Bearer ", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if got := token.Authorizes(test.header); got != test.want {
+			t.Errorf("Authorizes(%q) = %v, want %v", test.header, got, test.want)
+		}
+	}
+
+	if (InboundToken{}).Authorizes("Bearer ") {
+		t.Errorf("an empty token authorizes an empty header")
+	}
+}
@@ -0,0 +1,489 @@
+package orgreminders
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The common subset of Markdown understood for event messages: ATX
+// headings, paragraphs, hard line breaks, emphasis, inline code, links,
+// images, bullet and numbered lists, blockquotes, fenced code and rules.
+
+type mdBlock struct {
+	kind     string // "p", "h", "code", "hr", "quote", "ul" or "ol"
+	level    int    // heading level, or the first number of an "ol"
+	text     string
+	children []mdBlock   // "quote" contents
+	items    [][]mdBlock // list item contents
+}
+
+var (
+	reMdHeading = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	reMdRule    = regexp.MustCompile(`^ {0,3}([-*_])(?:[ \t]*([-*_]))+[ \t]*$`)
+	reMdFence   = regexp.MustCompile("^ {0,3}(```+|~~~+)")
+	reMdQuote   = regexp.MustCompile(`^ {0,3}> ?(.*)$`)
+	reMdItem    = regexp.MustCompile(`^( {0,3})([-*+]|\d{1,9}[.)])(?:[ \t]+(.*))?$`)
+	reMdBreak   = regexp.MustCompile(`(?: {2,}|\\)\n`)
+	reMdToken   = regexp.MustCompile("\x00(\\d+)\x00")
+	reMdAuto    = regexp.MustCompile(`^<((?:https?://|mailto:)[^<>\s]+)>`)
+
+	reMdStrong = []*regexp.Regexp{
+		regexp.MustCompile(`(?s)\*\*([^\s*](?:.*?[^\s*])??)\*\*`),
+		regexp.MustCompile(`(?s)(^|[^\w])__([^\s_](?:.*?[^\s_])??)__($|[^\w])`),
+	}
+	reMdEm = []*regexp.Regexp{
+		regexp.MustCompile(`\*([^\s*](?:[^*]*[^\s*])?)\*`),
+		regexp.MustCompile(`(^|[^\w])_([^\s_](?:[^_]*[^\s_])?)_($|[^\w])`),
+	}
+)
+
+// Render Markdown as HTML. The result is not sanitized, pass it through
+// SanitizeHTML before showing or sending it.
+func RenderMarkdown(src string) string {
+	return mdHTML(mdParse(mdLines(src)))
+}
+
+// Render Markdown as plain text, for the text part of emails and for texts.
+func MarkdownText(src string) string {
+	return strings.TrimSpace(mdText(mdParse(mdLines(src))))
+}
+
+func mdLines(src string) []string {
+	src = strings.Replace(src, "\r\n", "\n", -1)
+	src = strings.Replace(src, "\r", "\n", -1)
+	src = strings.Replace(src, "\x00", "", -1)
+	src = strings.Replace(src, "\t", "    ", -1)
+
+	return strings.Split(src, "\n")
+}
+
+func mdBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// Whether line starts a block other than a paragraph.
+func mdStartsBlock(line string) bool {
+	return reMdHeading.MatchString(line) || reMdRule.MatchString(line) ||
+		reMdFence.MatchString(line) || reMdQuote.MatchString(line) || reMdItem.MatchString(line)
+}
+
+func mdIndent(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func mdParse(lines []string) []mdBlock {
+	var blocks []mdBlock
+
+	for i := 0; i < len(lines); {
+		line := lines[i]
+
+		switch {
+		case mdBlank(line):
+			i++
+
+		case reMdFence.MatchString(line):
+			fence := strings.TrimSpace(reMdFence.FindString(line))
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				code = append(code, lines[i])
+			}
+			i++
+			blocks = append(blocks, mdBlock{kind: "code", text: strings.Join(code, "\n")})
+
+		case reMdHeading.MatchString(line):
+			m := reMdHeading.FindStringSubmatch(line)
+			blocks = append(blocks, mdBlock{kind: "h", level: len(m[1]), text: m[2]})
+			i++
+
+		case reMdRule.MatchString(line) && mdRuleChars(line):
+			blocks = append(blocks, mdBlock{kind: "hr"})
+			i++
+
+		case reMdQuote.MatchString(line):
+			var quoted []string
+			for ; i < len(lines) && !mdBlank(lines[i]); i++ {
+				if m := reMdQuote.FindStringSubmatch(lines[i]); m != nil {
+					quoted = append(quoted, m[1])
+				} else {
+					// Lazy continuation of the quoted paragraph
+					quoted = append(quoted, lines[i])
+				}
+			}
+			blocks = append(blocks, mdBlock{kind: "quote", children: mdParse(quoted)})
+
+		case reMdItem.MatchString(line):
+			var block mdBlock
+			block, i = mdParseList(lines, i)
+			blocks = append(blocks, block)
+
+		default:
+			var para []string
+			for ; i < len(lines) && !mdBlank(lines[i]); i++ {
+				if len(para) > 0 && mdStartsBlock(lines[i]) {
+					break
+				}
+				para = append(para, strings.TrimLeft(lines[i], " "))
+			}
+			blocks = append(blocks, mdBlock{kind: "p", text: strings.Join(para, "\n")})
+		}
+	}
+
+	return blocks
+}
+
+// A rule must use one character throughout, "- * -" is a list item.
+func mdRuleChars(line string) bool {
+	chars := strings.Replace(strings.TrimSpace(line), " ", "", -1)
+	return strings.Count(chars, chars[:1]) == len(chars)
+}
+
+func mdParseList(lines []string, i int) (mdBlock, int) {
+	first := reMdItem.FindStringSubmatch(lines[i])
+	ordered := first[2] != "-" && first[2] != "*" && first[2] != "+"
+	block := mdBlock{kind: "ul"}
+	if ordered {
+		block.kind = "ol"
+		block.level, _ = strconv.Atoi(first[2][:len(first[2])-1])
+	}
+
+	for i < len(lines) {
+		m := reMdItem.FindStringSubmatch(lines[i])
+		if m == nil || (m[2] != "-" && m[2] != "*" && m[2] != "+") != ordered {
+			break
+		}
+
+		// Item content lines, with the item's indentation removed
+		indent := len(m[1]) + len(m[2]) + 1
+		item := []string{m[3]}
+		for i++; i < len(lines); i++ {
+			line := lines[i]
+			if mdBlank(line) {
+				// Blank lines stay in the item if it carries on after them
+				if i+1 < len(lines) && !mdBlank(lines[i+1]) && mdIndent(lines[i+1]) >= indent {
+					item = append(item, "")
+					continue
+				}
+				break
+			}
+			if mdIndent(line) >= indent {
+				item = append(item, line[indent:])
+				continue
+			}
+			if reMdItem.MatchString(line) || mdStartsBlock(line) {
+				break
+			}
+			// Lazy continuation of the item's paragraph
+			item = append(item, line)
+		}
+		block.items = append(block.items, mdParse(item))
+
+		// A single blank line between items keeps the list going
+		if i < len(lines) && mdBlank(lines[i]) && i+1 < len(lines) && reMdItem.MatchString(lines[i+1]) {
+			i++
+		}
+	}
+
+	return block, i
+}
+
+func mdHTML(blocks []mdBlock) string {
+	var out []string
+
+	for _, b := range blocks {
+		switch b.kind {
+		case "p":
+			out = append(out, "<p>"+mdInline(b.text, true)+"</p>")
+		case "h":
+			out = append(out, fmt.Sprintf("<h%d>%s</h%d>", b.level, mdInline(b.text, true), b.level))
+		case "code":
+			out = append(out, "<pre><code>"+html.EscapeString(b.text)+"</code></pre>")
+		case "hr":
+			out = append(out, "<hr>")
+		case "quote":
+			out = append(out, "<blockquote>"+mdHTML(b.children)+"</blockquote>")
+		case "ul", "ol":
+			open := "<" + b.kind + ">"
+			if b.kind == "ol" && b.level != 1 {
+				open = fmt.Sprintf(`<ol start="%d">`, b.level)
+			}
+			var items []string
+			for _, item := range b.items {
+				// Simple items skip the paragraph around their text
+				if len(item) > 0 && item[0].kind == "p" {
+					items = append(items, "<li>"+mdInline(item[0].text, true)+mdHTML(item[1:])+"</li>")
+				} else {
+					items = append(items, "<li>"+mdHTML(item)+"</li>")
+				}
+			}
+			out = append(out, open+strings.Join(items, "")+"</"+b.kind+">")
+		}
+	}
+
+	return strings.Join(out, "\n")
+}
+
+func mdText(blocks []mdBlock) string {
+	var out []string
+
+	for _, b := range blocks {
+		switch b.kind {
+		case "p", "h":
+			out = append(out, mdInline(b.text, false))
+		case "code":
+			out = append(out, b.text)
+		case "hr":
+			out = append(out, "----------")
+		case "quote":
+			quoted := strings.Split(mdText(b.children), "\n")
+			for indx := range quoted {
+				quoted[indx] = strings.TrimRight("> "+quoted[indx], " ")
+			}
+			out = append(out, strings.Join(quoted, "\n"))
+		case "ul", "ol":
+			var items []string
+			for indx, item := range b.items {
+				marker := "- "
+				if b.kind == "ol" {
+					marker = strconv.Itoa(b.level+indx) + ". "
+				}
+				body := strings.Split(mdItemText(item), "\n")
+				for line := range body {
+					if line > 0 && body[line] != "" {
+						body[line] = strings.Repeat(" ", len(marker)) + body[line]
+					}
+				}
+				items = append(items, marker+strings.Join(body, "\n"))
+			}
+			out = append(out, strings.Join(items, "\n"))
+		}
+	}
+
+	return strings.Join(out, "\n\n")
+}
+
+// Text of a list item. A nested list follows the item's text without a
+// blank line.
+func mdItemText(item []mdBlock) string {
+	var out string
+
+	for indx, b := range item {
+		if indx > 0 {
+			if b.kind == "ul" || b.kind == "ol" {
+				out += "\n"
+			} else {
+				out += "\n\n"
+			}
+		}
+		out += mdText([]mdBlock{b})
+	}
+
+	return out
+}
+
+// Render the inline markup of a block, as HTML or as plain text.
+func mdInline(s string, asHTML bool) string {
+	var tokens []string
+	protect := func(out string) string {
+		tokens = append(tokens, out)
+		return "\x00" + strconv.Itoa(len(tokens)-1) + "\x00"
+	}
+	escape := func(text string) string {
+		if asHTML {
+			return html.EscapeString(text)
+		}
+		return text
+	}
+
+	s = reMdBreak.ReplaceAllStringFunc(s, func(string) string {
+		if asHTML {
+			return protect("<br>\n")
+		}
+		return protect("\n")
+	})
+
+	var rest []byte
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		// Backslash escapes
+		if c == '\\' && i+1 < len(s) && strings.IndexByte("\\`*_{}[]()#+-.!<>", s[i+1]) >= 0 {
+			rest = append(rest, protect(escape(s[i+1:i+2]))...)
+			i += 2
+			continue
+		}
+
+		// Code spans
+		if c == '`' {
+			run := len(s[i:]) - len(strings.TrimLeft(s[i:], "`"))
+			fence := s[i : i+run]
+			if end := strings.Index(s[i+run:], fence); end >= 0 {
+				code := strings.TrimSpace(s[i+run : i+run+end])
+				if asHTML {
+					code = "<code>" + html.EscapeString(code) + "</code>"
+				}
+				rest = append(rest, protect(code)...)
+				i += run + end + run
+				continue
+			}
+			rest = append(rest, fence...)
+			i += run
+			continue
+		}
+
+		// Autolinks
+		if c == '<' {
+			if m := reMdAuto.FindStringSubmatch(s[i:]); m != nil {
+				shown := strings.TrimPrefix(m[1], "mailto:")
+				if asHTML {
+					rest = append(rest, protect(`<a href="`+html.EscapeString(m[1])+`">`+html.EscapeString(shown)+`</a>`)...)
+				} else {
+					rest = append(rest, protect(shown)...)
+				}
+				i += len(m[0])
+				continue
+			}
+		}
+
+		// Links and images
+		image := c == '!' && i+1 < len(s) && s[i+1] == '['
+		if c == '[' || image {
+			start := i
+			if image {
+				start++
+			}
+			if text, url, title, n, ok := mdLink(s[start:]); ok {
+				// Unsafe URLs are left out, keeping just the text
+				schemes := []string{"http", "https", "mailto"}
+				if image {
+					schemes = schemes[:2]
+				}
+				if !sanitizeURL(url, schemes...) {
+					url = ""
+				}
+
+				var out string
+				switch {
+				case url == "" && image:
+					out = escape(text)
+				case url == "":
+					out = mdInline(text, asHTML)
+				case image && asHTML:
+					out = `<img src="` + html.EscapeString(url) + `" alt="` + html.EscapeString(text) + `"`
+					if title != "" {
+						out += ` title="` + html.EscapeString(title) + `"`
+					}
+					out += ">"
+				case image:
+					out = text
+				case asHTML:
+					out = `<a href="` + html.EscapeString(url) + `"`
+					if title != "" {
+						out += ` title="` + html.EscapeString(title) + `"`
+					}
+					out += ">" + mdInline(text, true) + "</a>"
+				default:
+					out = mdInline(text, false)
+					if out != url && "mailto:"+out != url {
+						out += " (" + url + ")"
+					}
+				}
+				rest = append(rest, protect(out)...)
+				i = start + n
+				continue
+			}
+		}
+
+		rest = append(rest, c)
+		i++
+	}
+
+	result := escape(string(rest))
+	for indx, re := range reMdStrong {
+		result = re.ReplaceAllStringFunc(result, func(m string) string {
+			return mdEmphasis(re, m, indx == 1, "strong", asHTML)
+		})
+	}
+	for indx, re := range reMdEm {
+		result = re.ReplaceAllStringFunc(result, func(m string) string {
+			return mdEmphasis(re, m, indx == 1, "em", asHTML)
+		})
+	}
+
+	return reMdToken.ReplaceAllStringFunc(result, func(m string) string {
+		indx, _ := strconv.Atoi(reMdToken.FindStringSubmatch(m)[1])
+		return tokens[indx]
+	})
+}
+
+// Replace one emphasis match. Underscore patterns capture the characters
+// around them, which are kept.
+func mdEmphasis(re *regexp.Regexp, m string, bounded bool, tag string, asHTML bool) string {
+	parts := re.FindStringSubmatch(m)
+	before, inner, after := "", parts[1], ""
+	if bounded {
+		before, inner, after = parts[1], parts[2], parts[3]
+	}
+
+	if asHTML {
+		return before + "<" + tag + ">" + inner + "</" + tag + ">" + after
+	}
+	return before + inner + after
+}
+
+// Parse "[text](url "title")" at the start of s, returning its parts and
+// length.
+func mdLink(s string) (text string, url string, title string, n int, ok bool) {
+	depth := 0
+	close := -1
+	for i := 0; i < len(s) && close < 0; i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				close = i
+			}
+		}
+	}
+	if close < 0 || close+1 >= len(s) || s[close+1] != '(' {
+		return
+	}
+
+	// URLs may contain balanced parentheses
+	end := -1
+	depth = 0
+	for i := close + 2; i < len(s) && end < 0; i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				end = i - (close + 2)
+			}
+			depth--
+		}
+	}
+	if end < 0 {
+		return
+	}
+	target := strings.TrimSpace(s[close+2 : close+2+end])
+
+	if sp := strings.IndexAny(target, " \t\n"); sp >= 0 {
+		title = strings.TrimSpace(target[sp:])
+		target = target[:sp]
+		if len(title) >= 2 && (title[0] == '"' || title[0] == '\'') && title[len(title)-1] == title[0] {
+			title = title[1 : len(title)-1]
+		} else {
+			return
+		}
+	}
+	target = strings.TrimSuffix(strings.TrimPrefix(target, "<"), ">")
+
+	return s[1:close], target, title, close + 2 + end + 1, true
+}
@@ -0,0 +1,82 @@
+package orgreminders
+
+import "testing"
+
+func TestRenderMarkdown(t *testing.T) {
+	var tests = []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"paragraphs", "one\ntwo\n\nthree", "<p>one\ntwo</p>\n<p>three</p>"},
+		{"heading", "## Agenda ##", "<h2>Agenda</h2>"},
+		{"hard break", "one  \ntwo", "<p>one<br>\ntwo</p>"},
+		{"escaped html", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>"},
+
+		{"em", "*a* and _b_", "<p><em>a</em> and <em>b</em></p>"},
+		{"strong", "**a** and __b__", "<p><strong>a</strong> and <strong>b</strong></p>"},
+		{"strong and em", "***a***", "<p><em><strong>a</strong></em></p>"},
+		{"em inside strong", "**bold *it* bold**", "<p><strong>bold <em>it</em> bold</strong></p>"},
+		{"strong inside em", "*it **bold** it*", "<p><em>it <strong>bold</strong> it</em></p>"},
+		{"two strong spans", "**a** b **c**", "<p><strong>a</strong> b <strong>c</strong></p>"},
+		{"intraword underscores", "snake_case_name", "<p>snake_case_name</p>"},
+		{"spaced stars", "a * b * c", "<p>a * b * c</p>"},
+		{"code span", "`*x* <b>`", "<p><code>*x* &lt;b&gt;</code></p>"},
+		{"backslash escape", `\*not em\*`, "<p>*not em*</p>"},
+
+		{"bullet list", "- one\n- two", "<ul><li>one</li><li>two</li></ul>"},
+		{"nested list", "- one\n  - nested\n- two", "<ul><li>one<ul><li>nested</li></ul></li><li>two</li></ul>"},
+		{"numbered list", "1. a\n2. b", "<ol><li>a</li><li>b</li></ol>"},
+		{"numbered list start", "3. c\n4. d", `<ol start="3"><li>c</li><li>d</li></ol>`},
+		{"rule not list", "- - -", "<hr>"},
+
+		{"fence", "```\n<b>x</b>\n*y*\n```", "<pre><code>&lt;b&gt;x&lt;/b&gt;\n*y*</code></pre>"},
+		{"fence with info", "```go\nfunc() {}\n```", "<pre><code>func() {}</code></pre>"},
+		{"tilde fence", "~~~\nx\n~~~", "<pre><code>x</code></pre>"},
+		{"unclosed fence", "```\nx", "<pre><code>x</code></pre>"},
+
+		{"blockquote", "> one\n> two", "<blockquote><p>one\ntwo</p></blockquote>"},
+		{"blockquote paragraphs", "> a\n>\n> b", "<blockquote><p>a</p>\n<p>b</p></blockquote>"},
+		{"blockquote list", "> - item", "<blockquote><ul><li>item</li></ul></blockquote>"},
+
+		{"link", "[x](https://example.com/)", `<p><a href="https://example.com/">x</a></p>`},
+		{"link title", `[x](https://example.com/ "T")`, `<p><a href="https://example.com/" title="T">x</a></p>`},
+		{"link parens", "[x](https://example.com/a_(b))", `<p><a href="https://example.com/a_(b)">x</a></p>`},
+		{"link emphasis", "[*x*](/x)", `<p><a href="/x"><em>x</em></a></p>`},
+		{"link quote breakout", `[x](/a"onclick="alert(1))`, `<p><a href="/a&#34;onclick=&#34;alert(1)">x</a></p>`},
+		{"autolink", "<https://example.com/>", `<p><a href="https://example.com/">https://example.com/</a></p>`},
+		{"javascript link", "[x](javascript:alert(1))", "<p>x</p>"},
+		{"javascript link mixed case", "[x](JavaScript:alert(1))", "<p>x</p>"},
+		{"javascript autolink", "<javascript:alert(1)>", "<p>&lt;javascript:alert(1)&gt;</p>"},
+		{"image", "![i](https://example.com/i.png)", `<p><img src="https://example.com/i.png" alt="i"></p>`},
+		{"data image", "![i](data:image/png;base64,AA)", "<p>i</p>"},
+	}
+
+	for _, test := range tests {
+		if got := RenderMarkdown(test.in); got != test.want {
+			t.Errorf("%s: RenderMarkdown(%q) = %q, want %q", test.name, test.in, got, test.want)
+		}
+	}
+}
+
+func TestMarkdownText(t *testing.T) {
+	var tests = []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"emphasis", "**bold *it* bold**", "bold it bold"},
+		{"lists", "- one\n  - nested\n- two\n\n3. c\n4. d", "- one\n  - nested\n- two\n\n3. c\n4. d"},
+		{"fence", "```\n<b>x</b>\n```", "<b>x</b>"},
+		{"blockquote", "> a\n>\n> b", "> a\n>\n> b"},
+		{"link", "[x](https://example.com/)", "x (https://example.com/)"},
+		{"mailto link", "[a@example.com](mailto:a@example.com)", "a@example.com"},
+		{"javascript link", "[x](javascript:alert(1))", "x"},
+	}
+
+	for _, test := range tests {
+		if got := MarkdownText(test.in); got != test.want {
+			t.Errorf("%s: MarkdownText(%q) = %q, want %q", test.name, test.in, got, test.want)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"appengine/datastore"
 	"errors"
 	"regexp"
+	"time"
 )
 
 type Member struct {
@@ -18,15 +19,75 @@ type Member struct {
 	EmailOn  bool
 	Orgs     []string
 	WebUser  bool
+	// Overrides the organization's quiet hours when set
+	QuietStart string
+	QuietEnd   string
+	// Due times in digests are shown in this zone, blank = first org's
+	TimeZone string
+	// "daily" or "weekly" to get a digest instead of individual reminders
+	Digest     string
+	DigestSent time.Time
+	// "<org>/<channel>" for each organization's reminders the member
+	// unsubscribed from
+	Unsubscribed []string
 }
 
 type Members []Member
 
+// A member a reminder is delivered to, and the address used for the channel.
+// Org is the organization the member is reached through; its name and
+// quiet hours apply to the message.
+type Recipient struct {
+	Member  Member
+	Address string
+	Org     Organization
+}
+
+// Everyone reached through any of orgs on channel t, once per person and
+// address. Members of several of the orgs are reached through the first
+// one listed.
+func ResolveRecipients(c appengine.Context, orgs []Organization, t string) []Recipient {
+	var members = make([]Members, len(orgs))
+	for indx, o := range orgs {
+		members[indx] = o.GetMemberList(c)
+	}
+
+	return resolveRecipients(orgs, members, t)
+}
+
+// ResolveRecipients for members already loaded, members[i] being those of
+// orgs[i] in name order. People are told apart by their member key, not
+// their name, which two of them can share.
+func resolveRecipients(orgs []Organization, members []Members, t string) []Recipient {
+	recipients := []Recipient{}
+	seenMember := map[string]bool{}
+	seenAddr := map[string]bool{}
+
+	for indx, o := range orgs {
+		for _, m := range members[indx] {
+			var addr = m.OrgAddress(o.Name, t)
+
+			// get rid of duplicate recipients
+			if addr == "" || seenMember[m.Key] || seenAddr[addr] {
+				continue
+			}
+			seenMember[m.Key] = true
+			seenAddr[addr] = true
+			recipients = append(recipients, Recipient{Member: m, Address: addr, Org: o})
+		}
+	}
+
+	return recipients
+}
+
 func (slice Members) Len() int {
 	return len(slice)
 }
 
 func (slice Members) Less(i, j int) bool {
+	if slice[i].Name == slice[j].Name {
+		return slice[i].Key < slice[j].Key
+	}
 	return slice[i].Name < slice[j].Name
 }
 
@@ -79,6 +140,26 @@ func GetMemberByEmail(c appengine.Context, email string) (result Member, err err
 	return
 }
 
+// Address to use for the member over channel t, if they want it.
+func (m Member) Address(t string) string {
+	if t == "email" && m.EmailOn {
+		return m.Email
+	} else if t == "text" && m.TextOn {
+		return m.TextAddr
+	}
+
+	return ""
+}
+
+// Quiet hours that apply to the member within organization o.
+func (m Member) Quiet(o Organization) QuietHours {
+	if m.QuietStart != "" || m.QuietEnd != "" {
+		return QuietHours{Start: m.QuietStart, End: m.QuietEnd}
+	}
+
+	return o.Quiet()
+}
+
 func GetMemberByKey(c appengine.Context, key string) (bool, Member) {
 	var result = new(Member)
 	var okay = false
@@ -98,6 +179,7 @@ func GetMemberByKey(c appengine.Context, key string) (bool, Member) {
 		okay = true
 	}
 
+	result.Key = key
 	return okay, *result
 }
 
@@ -107,9 +189,11 @@ func (m Member) Save(c appengine.Context) (bool, string) {
 	key := datastore.NewIncompleteKey(c, "Member", nil)
 	keyNew, err := datastore.Put(c, key, &m)
 	if err != nil {
-		result = false
+		c.Infof("member.Save error: %v", err)
+		return result, ""
 	}
 
+	result = true
 	return result, keyNew.Encode()
 }
 
@@ -124,7 +208,9 @@ func (m Member) Update(c appengine.Context, key string) bool {
 
 	_, err := datastore.Put(c, keyObj, &m)
 	if err != nil {
-		result = false
+		c.Infof("member.Update error: %v", err)
+	} else {
+		result = true
 	}
 
 	return result
@@ -0,0 +1,39 @@
+package orgreminders
+
+import "testing"
+
+func TestResolveRecipients(t *testing.T) {
+	var ops = Organization{Name: "Ops"}
+	var dev = Organization{Name: "Dev"}
+
+	var annA = Member{Key: "a", Name: "Ann Smith", Email: "ann@example.com", EmailOn: true, Orgs: []string{"Ops", "Dev"}}
+	var annB = Member{Key: "b", Name: "Ann Smith", Email: "asmith@example.com", EmailOn: true, Orgs: []string{"Ops"}}
+	var bob = Member{Key: "c", Name: "Bob", Email: "bob@example.com", EmailOn: true, Orgs: []string{"Dev"}}
+	var shared = Member{Key: "d", Name: "Bob's phone", Email: "bob@example.com", EmailOn: true, Orgs: []string{"Dev"}}
+	var off = Member{Key: "e", Name: "Carl", Email: "carl@example.com", Orgs: []string{"Dev"}}
+
+	got := resolveRecipients(
+		[]Organization{ops, dev},
+		[]Members{{annA, annB}, {annA, bob, shared, off}},
+		"email",
+	)
+
+	var want = []struct {
+		key  string
+		addr string
+		org  string
+	}{
+		{"a", "ann@example.com", "Ops"},
+		{"b", "asmith@example.com", "Ops"},
+		{"c", "bob@example.com", "Dev"},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d recipients, want %d: %+v", len(got), len(want), got)
+	}
+	for indx, w := range want {
+		if got[indx].Member.Key != w.key || got[indx].Address != w.addr || got[indx].Org.Name != w.org {
+			t.Errorf("recipient %d = %s %s via %s, want %s %s via %s", indx, got[indx].Member.Key, got[indx].Address, got[indx].Org.Name, w.key, w.addr, w.org)
+		}
+	}
+}
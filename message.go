@@ -0,0 +1,141 @@
+package orgreminders
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"strings"
+	"time"
+)
+
+// Values that can be dropped into an event's messages as {{placeholders}},
+// filled in separately for every recipient.
+type MessageVars struct {
+	Name      string
+	Title     string
+	Due       string
+	Remaining string
+	Org       string
+}
+
+// An event's messages as one recipient will get them.
+type MessagePreview struct {
+	Vars     MessageVars
+	Subject  string
+	Email    template.HTML
+	Text     string
+	SMS      SMSInfo
+	SMSParts []string
+}
+
+// Placeholders understood in event messages, with what they stand for.
+var MessagePlaceholders = [][]string{
+	{"{{name}}", "member's name"},
+	{"{{title}}", "event title"},
+	{"{{due}}", "due date/time in the event's time zone"},
+	{"{{remaining}}", "time left until due"},
+	{"{{org}}", "organization name"},
+}
+
+// Message values for sending e to rcpt at now.
+func NewMessageVars(e Event, rcpt Recipient, now time.Time) MessageVars {
+	var due = e.Due.In(e.Zone(rcpt.Org))
+
+	return MessageVars{
+		Name:      rcpt.Member.Name,
+		Title:     e.Title,
+		Due:       due.Format("01/02/2006 3:04pm MST"),
+		Remaining: Remaining(e.Due.Sub(now)),
+		Org:       rcpt.Org.Name,
+	}
+}
+
+func (v MessageVars) replacer(escape func(string) string) *strings.Replacer {
+	return strings.NewReplacer(
+		"{{name}}", escape(v.Name),
+		"{{title}}", escape(v.Title),
+		"{{due}}", escape(v.Due),
+		"{{remaining}}", escape(v.Remaining),
+		"{{org}}", escape(v.Org),
+	)
+}
+
+// The event's messages with the placeholders filled in. Texts are fitted
+// to o's limit and policy, with link to the full message.
+func (v MessageVars) Preview(e Event, o Organization, link string) MessagePreview {
+	var text = v.SMS(e)
+
+	return MessagePreview{
+		Vars:     v,
+		Subject:  e.Title,
+		Email:    v.HTML(e.EmailMessage),
+		Text:     text,
+		SMS:      MeasureSMS(text),
+		SMSParts: SMSParts(text, o.SMSLimit(), o.SMSPolicy, link),
+	}
+}
+
+// Body of the event's text messages, the plain email body unless a text
+// message of its own was written.
+func (v MessageVars) SMS(e Event) string {
+	if strings.TrimSpace(e.TextMessage) == "" {
+		return v.Text(e.PlainBody())
+	}
+
+	return v.Text(e.TextMessage)
+}
+
+// Fill in the placeholders of a plain text message. Unknown placeholders
+// are left as they are.
+func (v MessageVars) Text(msg string) string {
+	return v.replacer(func(s string) string { return s }).Replace(msg)
+}
+
+// Fill in the placeholders of an HTML message, escaping the values. The
+// result is sanitized afterwards, so a value that lands in an attribute
+// (say a link) is checked like the rest of the message.
+func (v MessageVars) HTML(msg template.HTML) template.HTML {
+	return SanitizeHTML(v.replacer(html.EscapeString).Replace(string(msg)))
+}
+
+// Human friendly time left, e.g. "2 days 3 hours" or "overdue by 5 minutes".
+func Remaining(d time.Duration) string {
+	if d < 0 {
+		return "overdue by " + Remaining(-d)
+	}
+
+	d -= d % time.Minute
+	if d < time.Minute {
+		return "less than a minute"
+	}
+
+	var parts []string
+	var units = []struct {
+		name string
+		size time.Duration
+	}{
+		{"day", Duration_Day},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+	}
+	for _, unit := range units {
+		n := int(d / unit.size)
+		d -= time.Duration(n) * unit.size
+		if n == 0 {
+			continue
+		}
+
+		part := fmt.Sprintf("%d %s", n, unit.name)
+		if n != 1 {
+			part += "s"
+		}
+		parts = append(parts, part)
+
+		// Two units are plenty, "2 days 3 hours" not "2 days 3 hours 4 minutes"
+		if len(parts) == 2 {
+			break
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,100 @@
+package orgreminders
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewMessageVarsZone(t *testing.T) {
+	if !ValidTimeZone("America/Chicago") || !ValidTimeZone("Europe/London") {
+		t.Skip("no time zone data")
+	}
+
+	var now = time.Date(2014, 3, 10, 12, 0, 0, 0, time.UTC)
+	var rcpt = Recipient{Member: Member{Name: "Ann"}, Org: Organization{Name: "Ops", TimeZone: "Europe/London"}}
+	var e = Event{Title: "Report", Due: time.Date(2014, 3, 10, 14, 30, 0, 0, time.UTC)}
+
+	if got := NewMessageVars(e, rcpt, now).Due; got != "03/10/2014 2:30pm GMT" {
+		t.Errorf("without an event zone: due %q, want the organization's zone", got)
+	}
+
+	e.TimeZone = "America/Chicago"
+	if got := NewMessageVars(e, rcpt, now).Due; got != "03/10/2014 9:30am CDT" {
+		t.Errorf("with an event zone: due %q, want the event's zone", got)
+	}
+}
+
+func TestRemaining(t *testing.T) {
+	var tests = []struct {
+		in   time.Duration
+		want string
+	}{
+		{0, "less than a minute"},
+		{59 * time.Second, "less than a minute"},
+		{time.Minute, "1 minute"},
+		{time.Minute + 59*time.Second, "1 minute"},
+		{2 * time.Minute, "2 minutes"},
+		{59*time.Minute + 59*time.Second, "59 minutes"},
+		{time.Hour, "1 hour"},
+		{time.Hour + time.Minute, "1 hour 1 minute"},
+		{2*time.Hour + 30*time.Minute + 59*time.Second, "2 hours 30 minutes"},
+		{23*time.Hour + 59*time.Minute + 59*time.Second, "23 hours 59 minutes"},
+		{24 * time.Hour, "1 day"},
+		{24*time.Hour + 59*time.Second, "1 day"},
+		{24*time.Hour + 5*time.Minute, "1 day 5 minutes"},
+		{2*24*time.Hour + 3*time.Hour + 4*time.Minute, "2 days 3 hours"},
+		{-30 * time.Second, "overdue by less than a minute"},
+		{-time.Minute, "overdue by 1 minute"},
+		{-(time.Hour + 90*time.Second), "overdue by 1 hour 1 minute"},
+		{-3 * 24 * time.Hour, "overdue by 3 days"},
+	}
+
+	for _, test := range tests {
+		if got := Remaining(test.in); got != test.want {
+			t.Errorf("Remaining(%v) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestMessageVarsText(t *testing.T) {
+	var vars = MessageVars{Name: "Ann", Title: "Budget", Due: "03/10/2014 9:30am CDT", Remaining: "2 days", Org: "Ops & Co"}
+
+	var tests = []struct {
+		in   string
+		want string
+	}{
+		{"Hi {{name}}", "Hi Ann"},
+		{"{{title}} is due {{due}}, {{remaining}} left ({{org}})", "Budget is due 03/10/2014 9:30am CDT, 2 days left (Ops & Co)"},
+		{"{{name}} {{name}}", "Ann Ann"},
+		{"{{unknown}} {{ name }} {{Name}}", "{{unknown}} {{ name }} {{Name}}"},
+		{"no placeholders", "no placeholders"},
+	}
+
+	for _, test := range tests {
+		if got := vars.Text(test.in); got != test.want {
+			t.Errorf("Text(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+
+	// Values are not themselves expanded
+	vars.Name = "{{title}}"
+	if got := vars.Text("{{name}}"); got != "{{title}}" {
+		t.Errorf("a value holding a placeholder was expanded: %q", got)
+	}
+
+	if got := vars.HTML("<p>{{org}}</p>"); got != "<p>Ops &amp; Co</p>" {
+		t.Errorf("HTML escaping: got %q", got)
+	}
+}
+
+func TestNewMessageVarsRemaining(t *testing.T) {
+	var now = time.Date(2014, 3, 10, 12, 0, 30, 0, time.UTC)
+	var e = Event{Due: time.Date(2014, 3, 12, 15, 0, 0, 0, time.UTC)}
+
+	if got := NewMessageVars(e, Recipient{}, now).Remaining; got != "2 days 2 hours" {
+		t.Errorf("Remaining before due: %q", got)
+	}
+	if got := NewMessageVars(e, Recipient{}, e.Due.Add(90*time.Minute)).Remaining; got != "overdue by 1 hour 30 minutes" {
+		t.Errorf("Remaining after due: %q", got)
+	}
+}
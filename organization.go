@@ -9,13 +9,21 @@ import (
 )
 
 type Organization struct {
-	Name          string
-	Description   string
-	Saved         time.Time
-	Created       time.Time
-	Active        bool
-	Expires       time.Time
-	TimeZone      string
+	Name        string
+	Description string
+	Saved       time.Time
+	Created     time.Time
+	Active      bool
+	Expires     time.Time
+	TimeZone    string
+	QuietStart  string
+	QuietEnd    string
+	Workweek    []int
+	Holidays    []string
+	SMSLength   int
+	SMSPolicy   string
+	// Chat incoming webhooks, "<format> <url>"
+	ChatWebhooks  []string `datastore:",noindex"`
 	Administrator []string
 	Members       map[string]Member `datastore:"-"`
 }
@@ -104,19 +112,20 @@ func GetOrganizationsByUser(c appengine.Context, u string) map[string]Organizati
 }
 
 // Save an organization to the database
-func (o Organization) Save(c appengine.Context) bool {
+func (o Organization) Save(c appengine.Context) (bool, string) {
 	var result bool
 
 	key := datastore.NewIncompleteKey(c, "Organization", nil)
 
 	o.Saved = time.Now().UTC()
-	_, err := datastore.Put(c, key, &o)
+	keyNew, err := datastore.Put(c, key, &o)
 	if err != nil {
 		c.Infof("org.Save error: %v", err)
-		result = false
+		return result, ""
 	}
 
-	return result
+	result = true
+	return result, keyNew.Encode()
 }
 
 func (o Organization) Update(c appengine.Context, key string) bool {
@@ -131,22 +140,26 @@ func (o Organization) Update(c appengine.Context, key string) bool {
 	o.Saved = time.Now().UTC()
 	_, err := datastore.Put(c, keyObj, &o)
 	if err != nil {
-		result = false
+		c.Infof("org.Update error: %v", err)
+	} else {
+		result = true
 	}
 
 	return result
 }
 
-func (o Organization) GetEvents(c appengine.Context, active bool) map[string]Event {
+func (o Organization) GetEvents(c appengine.Context, clock Clock, active bool) map[string]Event {
 	// Attempt a DB retrieve
 	var dbResults []Event
 	mapResults := make(map[string]Event)
-	q := datastore.NewQuery("Event").Project("Orgs", "Due", "Email", "Text", "Title","EmailMessage","TextMessage")
+	q := datastore.NewQuery("Event").Project("Orgs", "Due", "Email", "Text", "Title", "EmailMessage", "TextMessage")
 	utcLoc, _ := time.LoadLocation("UTC")
-	var today = time.Date(time.Now().Year(), time.Now().Month(), time.Now().Day(), 0, 0, 0, 0, utcLoc)
+	var now = clock.Now()
+	var today = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, utcLoc)
 
+	// Recently overdue events stay active for their follow-up reminders
 	if active {
-		q = q.Filter("Due >= ", today)
+		q = q.Filter("Due >= ", today.Add(-FollowUpWindow))
 	}
 
 	keys, err := q.GetAll(c, &dbResults)
@@ -157,8 +170,9 @@ func (o Organization) GetEvents(c appengine.Context, active bool) map[string]Eve
 	for indx, event := range dbResults {
 		for _, eorg := range event.Orgs {
 			if eorg == o.Name {
+				event.EmailMessage = SanitizeHTML(string(event.EmailMessage))
 				mapResults[keys[indx].Encode()] = event
-				break;
+				break
 			}
 		}
 	}
@@ -166,10 +180,79 @@ func (o Organization) GetEvents(c appengine.Context, active bool) map[string]Eve
 	return mapResults
 }
 
+// Time zone of the organization, UTC if it is missing or invalid.
+func (o Organization) Location() *time.Location {
+	location, err := time.LoadLocation(o.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+
+	return location
+}
+
+// Working days of the organization.
+func (o Organization) Calendar() Calendar {
+	return Calendar{Workweek: o.Workweek, Holidays: o.Holidays}
+}
+
+// Working weekdays of the organization, indexed by time.Weekday.
+func (o Organization) WorkDays() []bool {
+	var result = make([]bool, 7)
+	var week = Calendar{Workweek: o.Workweek}
+
+	for day := range result {
+		// Any week will do, only the weekday matters
+		var date = time.Date(2006, 1, 1+day, 12, 0, 0, 0, time.UTC)
+		result[date.Weekday()] = week.WorkingDay(date)
+	}
+
+	return result
+}
+
+// Quiet hours of the organization.
+func (o Organization) Quiet() QuietHours {
+	return QuietHours{Start: o.QuietStart, End: o.QuietEnd}
+}
+
+// Longest text message generated for the organization's members.
+func (o Organization) SMSLimit() int {
+	if o.SMSLength <= 0 {
+		return DefaultSMSLength
+	}
+
+	return o.SMSLength
+}
+
+// Chat webhooks reminders are posted to. Entries that don't parse are
+// skipped.
+func (o Organization) ChatHooks() []ChatHook {
+	var result []ChatHook
+
+	for _, line := range o.ChatWebhooks {
+		if hook, err := ParseChatHook(line); err == nil {
+			result = append(result, hook)
+		}
+	}
+
+	return result
+}
+
+// Members of the organization, keyed by name for the forms. Members who
+// share a name are listed once, so use GetMemberList to reach everyone.
 func (o Organization) GetMembers(c appengine.Context) map[string]Member {
+	mapResults := make(map[string]Member)
+
+	for _, member := range o.GetMemberList(c) {
+		mapResults[member.Name] = member
+	}
+
+	return mapResults
+}
+
+// Every member of the organization, sorted by name.
+func (o Organization) GetMemberList(c appengine.Context) Members {
 	// Attempt a DB retrieve
 	var dbResults Members
-	mapResults := make(map[string]Member)
 	q := datastore.NewQuery("Member").Filter("Orgs = ", o.Name).Order("Name")
 
 	keys, err := q.GetAll(c, &dbResults)
@@ -177,13 +260,11 @@ func (o Organization) GetMembers(c appengine.Context) map[string]Member {
 		c.Infof("GetMembers DB lookup error: %v", err)
 	}
 
-	// Sort our list of members by Name
-	sort.Sort(dbResults)
-
-	for indx, member := range dbResults {
-		member.Key = keys[indx].Encode()
-		mapResults[member.Name] = member
+	// Keys first, sorting moves the members around
+	for indx := range dbResults {
+		dbResults[indx].Key = keys[indx].Encode()
 	}
+	sort.Sort(dbResults)
 
-	return mapResults
+	return dbResults
 }
@@ -6,10 +6,13 @@ import (
 	"appengine/mail"
 	"appengine/user"
 	"fmt"
+	"html"
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -34,11 +37,19 @@ var TemplateFiles = []string{
 	"tmpl/new-member.html",
 	"tmpl/members.html",
 	"tmpl/editmember.html",
+	"tmpl/simulate.html",
+	"tmpl/ack.html",
+	"tmpl/tzcheck.html",
+	"tmpl/preview.html",
+	"tmpl/message.html",
+	"tmpl/webhooks.html",
+	"tmpl/unsubscribe.html",
 }
 
 type Page struct {
 	Error          string
 	Events         map[string]Event
+	Overdue        map[string]Event
 	Keys           []*datastore.Key
 	Event2Edit     Event
 	Organizations  map[string]Organization
@@ -57,6 +68,26 @@ type Page struct {
 	Member2Edit    Member
 	Member2EditKey string
 	ScheduleHTML   map[string][]string
+	Reminders      Reminders
+	SimFrom        string
+	SimTo          string
+	DryRun         bool
+	Acks           Acks
+	Ack            Ack
+	Escalation     Escalation
+	BackupKeys     map[string]bool
+	TimeZones      []string
+	FieldErrors    FieldErrors
+	Placeholders   [][]string
+	Preview        MessagePreview
+	Links          map[string]string
+	Endpoints      []Endpoint
+	Deliveries     []Delivery
+	HookTypes      []string
+	InboundURL     string
+	InboundToken   string
+	Subscription   SubscriptionChange
+	Changes        []SubscriptionChange
 }
 
 func NewPage(u *User) (*Page, error) {
@@ -100,12 +131,22 @@ func init() {
 	http.HandleFunc("/saveorg", OrgSaveHandler)
 	http.HandleFunc("/editorg", OrgEditHandler)
 	http.HandleFunc("/editevent", EventEditHandler)
+	http.HandleFunc("/deleteevent", EventDeleteHandler)
+	http.HandleFunc("/webhooks", WebhooksHandler)
+	http.HandleFunc("/inbound/", InboundHandler)
 	http.HandleFunc("/cron", CronHandler)
 	http.HandleFunc("/logout", LogoutHandler)
 	http.HandleFunc("/newmember", NewMemberHandler)
 	http.HandleFunc("/savemember", MemberSaveHandler)
 	http.HandleFunc("/members", MembersHandler)
 	http.HandleFunc("/editmember", MemberEditHandler)
+	http.HandleFunc("/simulate", SimulateHandler)
+	http.HandleFunc("/ack", AckHandler)
+	http.HandleFunc("/unsubscribe", UnsubscribeHandler)
+	http.HandleFunc("/m/", MessageHandler)
+	http.HandleFunc("/tzcheck", TimeZoneCheckHandler)
+	http.HandleFunc("/preview", PreviewHandler)
+	http.HandleFunc("/_ah/warmup", WarmupHandler)
 }
 
 func LogoutHandler(w http.ResponseWriter, r *http.Request) {
@@ -125,6 +166,7 @@ func DefaultHandler(w http.ResponseWriter, r *http.Request) {
 func NewOrgHandler(w http.ResponseWriter, r *http.Request) {
 	u := UserLookup(w, r)
 	p, _ := NewPage(&u)
+	p.TimeZones = TimeZones()
 
 	title := "new-org"
 	renderTemplate(w, title, p)
@@ -133,10 +175,19 @@ func NewOrgHandler(w http.ResponseWriter, r *http.Request) {
 func NewEventHandler(w http.ResponseWriter, r *http.Request) {
 	u := UserLookup(w, r)
 	p, _ := NewPage(&u)
+	c := appengine.NewContext(r)
 
 	title := "new-event"
+	p.TimeZones = TimeZones()
+	p.Placeholders = MessagePlaceholders
+	p.Members = make(map[string]Member)
 	for _, org := range u.Orgs {
 		p.Orgs = append(p.Orgs, org.Name)
+
+		// Candidates for escalation backups
+		for indx, member := range org.GetMembers(c) {
+			p.Members[indx] = member
+		}
 	}
 
 	sort.Strings(p.Orgs)
@@ -152,16 +203,15 @@ func EventSaveHandler(w http.ResponseWriter, r *http.Request) {
 
 	event := NewEvent()
 	event.Title = r.PostFormValue("title")
-	event.EmailMessage = template.HTML(r.PostFormValue("emailmessage"))
+	event.EmailMessage = SanitizeHTML(r.PostFormValue("emailmessage"))
 	event.TextMessage = r.PostFormValue("textmessage")
+	if r.PostFormValue("format") == "markdown" {
+		event.SetMarkdown(r.PostFormValue("markdown"))
+	}
 	event.Submitter = *u.Meta
 	event.Orgs = r.PostForm["orgs"]
-
-	if len(event.Orgs) < 1 {
-		p.Error = "You must choose an organization."
-		renderTemplate(w, "error", p)
-		return
-	}
+	event.Key = r.PostFormValue("key")
+	errs := FieldErrors{}
 
 	if r.PostFormValue("sendemail") == "on" {
 		event.Email = true
@@ -171,47 +221,79 @@ func EventSaveHandler(w http.ResponseWriter, r *http.Request) {
 		event.Text = true
 	}
 
+	if r.PostFormValue("urgent") == "on" {
+		event.Urgent = true
+	}
+
+	// escalation policy
+	var escerr error
+	event.EscalateAfter, escerr = strconv.Atoi(r.PostFormValue("escalateafter"))
+	if escerr != nil && r.PostFormValue("escalateafter") != "" {
+		errs.Add("escalateafter", "Escalation delay must be a number of minutes.")
+	}
+	event.Backups = r.PostForm["backups"]
+
 	// save reminder schedule
 	var remqtys = r.PostForm["remqty[]"]
 	var remtyps = r.PostForm["remtyp[]"]
+	var remats = r.PostForm["remat[]"]
 	for remkey, remval := range remqtys {
 		var entry = fmt.Sprintf("%s%s", remval, remtyps[remkey])
-		event.Reminders.Add(entry)
-	}
 
-	o, err := GetOrganizationByName(c, event.Orgs[0])
+		// follow-ups carry their marker in front of the offset, e.g. "+1d"
+		if strings.HasPrefix(remtyps[remkey], FollowUpPrefix) {
+			entry = FollowUpPrefix + remval + remtyps[remkey][len(FollowUpPrefix):]
+		}
 
-	if err != nil {
-		c.Infof("Error: %s", err.Error())
-		p.Error = err.Error()
-		renderTemplate(w, "error", p)
-		return
+		// absolute reminders carry their own date and time
+		if remtyps[remkey] == AbsolutePrefix {
+			var at string
+			if remkey < len(remats) {
+				at = remats[remkey]
+			}
+
+			// keep what was typed so the form can show it back
+			entry = AbsolutePrefix + at
+			t, timeerr := time.Parse(DueLayout, at)
+			if timeerr == nil {
+				entry = AbsolutePrefix + t.Format(AbsoluteLayout)
+			}
+		}
+
+		event.Reminders.Add(entry)
 	}
 
-	location, _ := time.LoadLocation(o.TimeZone)
-	const longForm = "01/02/2006 3:04pm"
-	t, timeerr := time.ParseInLocation(longForm, r.PostFormValue("due"), location)
-	if timeerr != nil {
-		http.Error(w, "Invalid time string", http.StatusInternalServerError)
+	event.TimeZone = r.PostFormValue("timezone")
+	errs.Merge(event.Prepare(c, SystemClock, r.PostFormValue("due")))
+
+	if len(errs) > 0 {
+		event.DueFormatted = r.PostFormValue("due")
+		p.Event2Edit = event
+		p.FieldErrors = errs
+		renderEventForm(w, c, &u, p)
 		return
 	}
 
-	event.Due = t
-
-	event.Key = r.PostFormValue("key")
+	created := event.Key == ""
+	saved := event.Store(c, SystemClock, created)
 	var subject = "Event Saved: "
-	if event.Key == "" {
-		_, event.Key = event.Save(c)
-	} else {
-		event.Update(c)
+	if created == false {
 		subject = "Event Updated: "
 	}
 
+	if saved == false {
+		event.DueFormatted = r.PostFormValue("due")
+		p.Event2Edit = event
+		p.Error = "Unable to save the event, please try again."
+		renderEventForm(w, c, &u, p)
+		return
+	}
+
 	if r.PostFormValue("oncreate") == "on" {
-		event.Notify(c, true)
+		event.Notify(c, SystemClock, true, false)
 	}
 
-	event.DueFormatted = event.Due.In(location).Format("01/02/2006 3:04pm")
+	event.DueFormatted = event.Due.In(event.Location(c)).Format("01/02/2006 3:04pm")
 	AdminNotify(c, u.Meta.Email, subject+event.Title, "The following event was just saved: <br><br>"+event.GetHTMLView(c))
 
 	p.Event2Edit = event
@@ -229,34 +311,176 @@ func EventEditHandler(w http.ResponseWriter, r *http.Request) {
 	ok, p.Event2Edit = GetEventByKey(c, r.FormValue("id"))
 
 	if ok {
-		org, _ := GetOrganizationByName(c, p.Event2Edit.Orgs[0])
-		location, _ := time.LoadLocation(org.TimeZone)
-		p.Event2Edit.DueFormatted = p.Event2Edit.Due.In(location).Format("01/02/2006 3:04pm")
-
-		uorgs := GetOrganizationsByUser(c, u.Meta.Email)
-		for _, uorg := range uorgs {
-			missing := true
-			for _, porg := range p.Event2Edit.Orgs {
-				if uorg.Name == porg {
-					missing = false
-					break
-				}
-			}
+		p.Event2Edit.DueFormatted = p.Event2Edit.Due.In(p.Event2Edit.Location(c)).Format("01/02/2006 3:04pm")
+		renderEventForm(w, c, &u, p)
+	} else {
+		p.Error = "Event not found."
+		renderTemplate(w, "error", p)
+	}
+}
 
-			if missing == true {
-				p.Orgs = append(p.Orgs, uorg.Name)
+// Delete an event. Administrators of all of its organizations delete it
+// outright, others only take it off the organizations they administer.
+func EventDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	u := UserLookup(w, r)
+	p, _ := NewPage(&u)
+	c := appengine.NewContext(r)
+
+	if r.Method != "POST" {
+		http.Redirect(w, r, "/events", http.StatusSeeOther)
+		return
+	}
+
+	ok, event := GetEventByKey(c, r.PostFormValue("key"))
+	if ok == false {
+		p.Error = "Event not found."
+		renderTemplate(w, "error", p)
+		return
+	}
+
+	// Administrators of only some of the event's orgs take it off theirs
+	var mine, others []string
+	for _, orgname := range event.Orgs {
+		if u.Administers(orgname) {
+			mine = append(mine, orgname)
+		} else {
+			others = append(others, orgname)
+		}
+	}
+	if len(mine) == 0 {
+		p.Error = "Access denied."
+		renderTemplate(w, "error", p)
+		return
+	}
+
+	if len(others) > 0 {
+		removed := event
+		removed.Orgs = mine
+		event.Orgs = others
+		if event.Store(c, SystemClock, false) == false {
+			p.Error = "Unable to remove the event, please try again."
+			renderTemplate(w, "error", p)
+			return
+		}
+		FireEventWebhook(c, SystemClock, HookEventDeleted, removed)
+		http.Redirect(w, r, "/events", http.StatusSeeOther)
+		return
+	}
+
+	if DeleteEvent(c, event.Key) == false {
+		p.Error = "Unable to delete the event, please try again."
+		renderTemplate(w, "error", p)
+		return
+	}
+
+	FireEventWebhook(c, SystemClock, HookEventDeleted, event)
+	http.Redirect(w, r, "/events", http.StatusSeeOther)
+}
+
+// Render the event editor for p.Event2Edit, which is either a stored event
+// or one that was submitted with errors.
+func renderEventForm(w http.ResponseWriter, c appengine.Context, u *User, p *Page) {
+	location := p.Event2Edit.Location(c)
+	p.TimeZones = TimeZones()
+	p.Placeholders = MessagePlaceholders
+
+	uorgs := GetOrganizationsByUser(c, u.Meta.Email)
+	for _, uorg := range uorgs {
+		missing := true
+		for _, porg := range p.Event2Edit.Orgs {
+			if uorg.Name == porg {
+				missing = false
+				break
 			}
 		}
 
-		// Extract usable event reminder list
-		p.ScheduleHTML = p.Event2Edit.Reminders.HTML()
+		if missing == true {
+			p.Orgs = append(p.Orgs, uorg.Name)
+		}
+	}
+
+	// Extract usable event reminder list
+	p.ScheduleHTML = p.Event2Edit.Reminders.HTML()
 
-		sort.Strings(p.Orgs)
-		renderTemplate(w, "editevent", p)
+	// Candidates for escalation backups
+	p.Members = make(map[string]Member)
+	p.BackupKeys = make(map[string]bool)
+	for _, uorg := range uorgs {
+		for indx, member := range uorg.GetMembers(c) {
+			p.Members[indx] = member
+		}
+	}
+	for _, backup := range p.Event2Edit.Backups {
+		p.BackupKeys[backup] = true
+	}
+
+	if p.Event2Edit.Key != "" {
+		_, p.Escalation = GetEscalation(c, p.Event2Edit.Key)
+
+		// Member acknowledgements and snoozes
+		p.Acks = GetAcksByEvent(c, p.Event2Edit.Key)
+		for indx, ack := range p.Acks {
+			p.Acks[indx].CreatedFormatted = ack.Created.In(location).Format("01/02/2006 3:04pm")
+			p.Acks[indx].UntilFormatted = ack.Until.In(location).Format("01/02/2006 3:04pm")
+		}
+	}
+
+	sort.Strings(p.Orgs)
+	renderTemplate(w, "editevent", p)
+}
+
+// Render the messages of the event being edited as a member would get
+// them, for the editor's live preview. The signed in user's own member
+// record stands in for the recipient when there is one.
+func PreviewHandler(w http.ResponseWriter, r *http.Request) {
+	u := UserLookup(w, r)
+	p, _ := NewPage(&u)
+	c := appengine.NewContext(r)
+
+	event := NewEvent()
+	event.Title = r.FormValue("title")
+	event.EmailMessage = SanitizeHTML(r.FormValue("emailmessage"))
+	event.TextMessage = r.FormValue("textmessage")
+	if r.FormValue("format") == "markdown" {
+		event.SetMarkdown(r.FormValue("markdown"))
+	}
+
+	rcpt := Recipient{Member: Member{Name: "Sample Member"}}
+	if m, err := GetMemberByEmail(c, u.Meta.Email); err == nil {
+		rcpt.Member = m
+	}
+
+	if orgs := r.Form["orgs"]; len(orgs) > 0 {
+		rcpt.Org, _ = GetOrganizationByName(c, orgs[0])
 	} else {
-		p.Error = "Event not found."
-		renderTemplate(w, "error", p)
+		for _, org := range u.Orgs {
+			rcpt.Org = org
+			break
+		}
+	}
+
+	location := rcpt.Org.Location()
+	if tz := r.FormValue("timezone"); ValidTimeZone(tz) {
+		location, _ = time.LoadLocation(tz)
+		event.TimeZone = tz
 	}
+
+	// Unparseable (or still empty) due dates preview as a day out
+	now := SystemClock.Now().In(location)
+	due, timeerr := ParseDue(r.FormValue("due"), now)
+	if timeerr != nil {
+		due = now.Add(Duration_Day)
+	}
+	event.Due = due
+
+	// Unsaved events get a link of typical length
+	link := MessageLink(c, r.FormValue("key"), rcpt.Member.Key)
+	if r.FormValue("key") == "" {
+		link = messageURL(c, 5629499534213120, 5639445604728832)
+	}
+
+	p.Preview = NewMessageVars(event, rcpt, now).Preview(event, rcpt.Org, link)
+	renderTemplate(w, "preview", p)
 }
 
 func OrgSaveHandler(w http.ResponseWriter, r *http.Request) {
@@ -269,24 +493,97 @@ func OrgSaveHandler(w http.ResponseWriter, r *http.Request) {
 	org.Description = r.PostFormValue("description")
 	org.Active = true
 	org.Expires = time.Now().UTC().Add(Duration_Week)
-	org.Administrator = strings.Split(r.PostFormValue("admin"), "\r\n")
+	errs := FieldErrors{}
+	for _, admin := range strings.Split(r.PostFormValue("admin"), "\n") {
+		if admin = strings.TrimSpace(admin); admin != "" {
+			org.Administrator = append(org.Administrator, admin)
+		}
+	}
 	org.TimeZone = r.PostFormValue("timezone")
+	org.QuietStart = r.PostFormValue("quietstart")
+	org.QuietEnd = r.PostFormValue("quietend")
+	if smslength := r.PostFormValue("smslength"); smslength != "" {
+		var smserr error
+		org.SMSLength, smserr = strconv.Atoi(smslength)
+		if smserr != nil {
+			errs.Add("smslength", "Text length must be a number of characters.")
+		}
+	}
+	org.SMSPolicy = r.PostFormValue("smspolicy")
+
+	// Working days, entered by hand and/or imported from an .ics file
+	for _, day := range r.PostForm["workweek"] {
+		if dayVal, err := strconv.Atoi(day); err == nil && dayVal >= 0 && dayVal <= 6 {
+			org.Workweek = append(org.Workweek, dayVal)
+		}
+	}
 
+	for _, holiday := range strings.Split(r.PostFormValue("holidays"), "\n") {
+		if holiday = strings.TrimSpace(holiday); holiday != "" {
+			org.Holidays = append(org.Holidays, holiday)
+		}
+	}
+
+	if icsFile, _, err := r.FormFile("holidayics"); err == nil {
+		holidays, icserr := ParseICSHolidays(icsFile)
+		icsFile.Close()
+		if icserr != nil {
+			errs.Add("holidayics", "Unable to read holiday calendar: "+icserr.Error())
+		}
+		org.Holidays = append(org.Holidays, holidays...)
+	}
+	org.Holidays = removeDuplicates(org.Holidays)
+	sort.Strings(org.Holidays)
+
+	for _, hook := range strings.Split(r.PostFormValue("chathooks"), "\n") {
+		if hook = strings.TrimSpace(hook); hook != "" {
+			org.ChatWebhooks = append(org.ChatWebhooks, hook)
+		}
+	}
+
+	// Organizations are looked up by name, so new ones need a fresh one
 	key := r.PostFormValue("key")
+	if key == "" && org.Name != "" {
+		if _, err := GetOrganizationByName(c, org.Name); err == nil {
+			errs.Add("name", "An organization with this name already exists.")
+		}
+	}
+	errs.Merge(org.Validate())
+
+	p.Org2Edit = org
+	p.Org2EditKey = key
+	if len(errs) > 0 {
+		p.FieldErrors = errs
+		renderOrgForm(w, p)
+		return
+	}
+
+	var saved bool
 	if key == "" {
 		c.Infof("saving org")
-		org.Save(c)
+		saved, p.Org2EditKey = org.Save(c)
 	} else {
 		c.Infof("updating org")
-		org.Update(c, key)
+		saved = org.Update(c, key)
+	}
+
+	if saved == false {
+		p.Error = "Unable to save the organization, please try again."
+		renderOrgForm(w, p)
+		return
 	}
 
 	p.SavedOrg = true
-	p.Org2Edit = org
-	p.Org2EditKey = key
 	renderTemplate(w, "save", p)
 }
 
+// Render the organization editor for p.Org2Edit. New organizations (no
+// p.Org2EditKey) get an editable name.
+func renderOrgForm(w http.ResponseWriter, p *Page) {
+	p.TimeZones = TimeZones()
+	renderTemplate(w, "editorg", p)
+}
+
 func OrgEditHandler(w http.ResponseWriter, r *http.Request) {
 	u := UserLookup(w, r)
 	p, _ := NewPage(&u)
@@ -295,22 +592,85 @@ func OrgEditHandler(w http.ResponseWriter, r *http.Request) {
 	p.Org2EditKey = r.FormValue("id")
 	p.Org2Edit = GetOrganizationByKey(c, p.Org2EditKey)
 
-	renderTemplate(w, "editorg", p)
+	renderOrgForm(w, p)
+}
+
+// Manage an organization's webhook endpoints and show their recent
+// deliveries.
+func WebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	u := UserLookup(w, r)
+	p, _ := NewPage(&u)
+	c := appengine.NewContext(r)
+
+	p.Org2EditKey = r.FormValue("id")
+	p.Org2Edit = GetOrganizationByKey(c, p.Org2EditKey)
+	org := p.Org2Edit
+	if org.Name == "" || u.Administers(org.Name) == false {
+		p.Error = "Access denied."
+		renderTemplate(w, "error", p)
+		return
+	}
+
+	if r.Method == "POST" {
+		r.ParseForm()
+		switch r.PostFormValue("action") {
+		case "add":
+			endpoint, err := NewEndpoint(org.Name, strings.TrimSpace(r.PostFormValue("url")), r.PostForm["types"])
+			if err != nil {
+				p.FieldErrors = FieldErrors{"url": err.Error()}
+			} else if endpoint.Save(c) == false {
+				p.Error = "Unable to save the webhook, please try again."
+			}
+		case "remove":
+			okay, endpoint := GetEndpointByKey(c, r.PostFormValue("endpoint"))
+			if okay && endpoint.Org == org.Name {
+				DeleteEndpoint(c, endpoint.Key)
+			}
+		case "token":
+			if okay, _ := NewInboundToken(c, org.Name); okay == false {
+				p.Error = "Unable to create a token, please try again."
+			}
+		}
+
+		if p.Error == "" && len(p.FieldErrors) == 0 {
+			http.Redirect(w, r, "/webhooks?id="+url.QueryEscape(p.Org2EditKey), http.StatusSeeOther)
+			return
+		}
+	}
+
+	p.Endpoints = GetEndpoints(c, org.Name)
+	p.Deliveries = GetDeliveries(c, org.Name, 50)
+	p.HookTypes = HookTypes
+	p.InboundURL = fmt.Sprintf("https://%s/inbound/%s", appengine.DefaultVersionHostname(c), p.Org2EditKey)
+	if okay, token := GetInboundToken(c, org.Name); okay {
+		p.InboundToken = token.Token
+	}
+	renderTemplate(w, "webhooks", p)
 }
 
 func EventsHandler(w http.ResponseWriter, r *http.Request) {
 	u := UserLookup(w, r)
 	p, _ := NewPage(&u)
 	p.Events = make(map[string]Event)
+	p.Overdue = make(map[string]Event)
 	c := appengine.NewContext(r)
+	now := SystemClock.Now()
 
+	// The projection leaves out the event's own time zone, so the events
+	// are loaded in full once across all the orgs
+	var keys []string
 	for _, org := range u.Orgs {
-		events := org.GetEvents(c, true)
-		location, _ := time.LoadLocation(org.TimeZone)
+		for indx := range org.GetEvents(c, SystemClock, true) {
+			keys = append(keys, indx)
+		}
+	}
 
-		for indx, event := range events {
-			event.Due = event.Due.In(location)
-			event.DueFormatted = event.Due.Format("01/02/2006 3:04pm")
+	for indx, event := range GetEventsByKey(c, removeDuplicates(keys)) {
+		event.Due = event.Due.In(event.Location(c))
+		event.DueFormatted = event.Due.Format("01/02/2006 3:04pm")
+		if event.Due.Before(now) {
+			p.Overdue[indx] = event
+		} else {
 			p.Events[indx] = event
 		}
 	}
@@ -355,6 +715,7 @@ func NewMemberHandler(w http.ResponseWriter, r *http.Request) {
 	p, _ := NewPage(&u)
 
 	title := "new-member"
+	p.TimeZones = TimeZones()
 	for _, org := range u.Orgs {
 		p.Orgs = append(p.Orgs, org.Name)
 	}
@@ -380,27 +741,35 @@ func MemberEditHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if ok {
-		uorgs := GetOrganizationsByUser(c, u.Meta.Email)
-		for _, uorg := range uorgs {
-			missing := true
-			for _, porg := range p.Member2Edit.Orgs {
-				if uorg.Name == porg {
-					missing = false
-					break
-				}
-			}
+		p.Changes = GetSubscriptionChanges(c, p.Member2EditKey)
+		renderMemberForm(w, c, &u, p)
+	} else {
+		p.Error = "Member not found or access denied."
+		renderTemplate(w, "error", p)
+	}
+}
 
-			if missing == true {
-				p.Orgs = append(p.Orgs, uorg.Name)
+// Render the member editor for p.Member2Edit, which is either a stored
+// member or one that was submitted with errors.
+func renderMemberForm(w http.ResponseWriter, c appengine.Context, u *User, p *Page) {
+	uorgs := GetOrganizationsByUser(c, u.Meta.Email)
+	for _, uorg := range uorgs {
+		missing := true
+		for _, porg := range p.Member2Edit.Orgs {
+			if uorg.Name == porg {
+				missing = false
+				break
 			}
 		}
 
-		sort.Strings(p.Orgs)
-		renderTemplate(w, "editmember", p)
-	} else {
-		p.Error = "Member not found or access denied."
-		renderTemplate(w, "error", p)
+		if missing == true {
+			p.Orgs = append(p.Orgs, uorg.Name)
+		}
 	}
+
+	sort.Strings(p.Orgs)
+	p.TimeZones = TimeZones()
+	renderTemplate(w, "editmember", p)
 }
 
 func MemberSaveHandler(w http.ResponseWriter, r *http.Request) {
@@ -417,6 +786,10 @@ func MemberSaveHandler(w http.ResponseWriter, r *http.Request) {
 	member.Carrier = r.PostFormValue("carrier")
 	member.TextAddr = GenTextAddr(member.Cell, member.Carrier)
 	member.Orgs = r.PostForm["orgs"]
+	member.QuietStart = r.PostFormValue("quietstart")
+	member.QuietEnd = r.PostFormValue("quietend")
+	member.TimeZone = r.PostFormValue("timezone")
+	member.Digest = r.PostFormValue("digest")
 
 	if r.PostFormValue("emailon") == "on" {
 		member.EmailOn = true
@@ -430,24 +803,75 @@ func MemberSaveHandler(w http.ResponseWriter, r *http.Request) {
 		member.WebUser = true
 	}
 
-	// Must have or don't save
-	if len(r.PostForm["orgs"]) <= 0 && member.WebUser == false {
-		p.Error = "Cannot save without an organization."
-		renderTemplate(w, "error", p)
+	key := r.PostFormValue("key")
+	var existing Member
+	if key != "" {
+		// Not on the form, but needed so a digest isn't sent twice
+		_, existing = GetMemberByKey(c, key)
+		member.DigestSent = existing.DigestSent
+
+		// Unsubscribes can only be undone here, unticked ones are dropped
+		for _, entry := range existing.Unsubscribed {
+			for _, kept := range r.PostForm["unsubscribed"] {
+				if kept == entry {
+					member.Unsubscribed = append(member.Unsubscribed, entry)
+				}
+			}
+		}
+	}
+	p.Member2Edit = member
+	p.Member2EditKey = key
+	if errs := member.Validate(); len(errs) > 0 {
+		p.FieldErrors = errs
+		renderMemberForm(w, c, &u, p)
 		return
 	}
 
-	key := r.PostFormValue("key")
+	var saved bool
 	if key == "" {
 		c.Infof("saving member")
-		_, key = member.Save(c)
+		saved, p.Member2EditKey = member.Save(c)
 	} else {
 		c.Infof("updating member")
-		member.Update(c, key)
+		saved = member.Update(c, key)
+	}
+
+	if saved == false {
+		p.Error = "Unable to save the member, please try again."
+		renderMemberForm(w, c, &u, p)
+		return
+	}
+
+	// Keep the subscription history complete
+	for _, channel := range []string{"email", "text"} {
+		if key != "" && existing.Subscribed(channel) != member.Subscribed(channel) {
+			change := SubscriptionChange{
+				Member:  key,
+				Name:    member.Name,
+				Channel: channel,
+				On:      member.Subscribed(channel),
+				Source:  "member editor (" + u.Meta.Email + ")",
+				When:    SystemClock.Now().UTC(),
+			}
+			change.Save(c)
+		}
+	}
+	for _, entry := range existing.Unsubscribed {
+		slash := strings.LastIndex(entry, "/")
+		if slash > 0 && member.OptedOut(entry[:slash], entry[slash+1:]) == false {
+			change := SubscriptionChange{
+				Member:  key,
+				Name:    member.Name,
+				Org:     entry[:slash],
+				Channel: entry[slash+1:],
+				On:      true,
+				Source:  "member editor (" + u.Meta.Email + ")",
+				When:    SystemClock.Now().UTC(),
+			}
+			change.Save(c)
+		}
 	}
 
-	p.Member2Edit = member
-	p.Member2EditKey = key
 	p.SavedMember = true
 	renderTemplate(w, "save", p)
 }
@@ -468,43 +892,115 @@ func AdminNotify(c appengine.Context, creator string, subject string, message st
 	}
 }
 
-func SendOrgMessage(c appengine.Context, o Organization, e Event, t string) (result bool) {
-	var appid = appengine.AppID(c)
-	var senderUserName = strings.Replace(o.Name, " ", "_", -1)
-	var sender = fmt.Sprintf("%s Reminders <%s@%s.appspotmail.com", o.Name, senderUserName, appid)
-	members := o.GetMembers(c)
-	recipients := []string{}
+// Send the event to the members of orgs over channel t, once per person,
+// skipping anyone who has already acknowledged it and holding back
+// non-urgent reminders for anyone in their quiet hours. With dryrun set the
+// messages are built but never handed to mail.Send.
+func SendEventMessage(c appengine.Context, clock Clock, orgs []Organization, e Event, t string, dryrun bool) (result bool, recipients []string, deferred Reminders) {
+	acked := AckedMembers(c, e.Key)
+	result = true
+
+	for _, rcpt := range Unacknowledged(ResolveRecipients(c, orgs, t), acked) {
+		var o = rcpt.Org
+		var now = clock.Now().In(o.Location())
+
+		if rcpt.Member.Digesting(e) {
+			c.Infof("%s gets a %s digest, skipping %s", rcpt.Member.Name, rcpt.Member.Digest, e.Title)
+			continue
+		}
 
-	for _, m := range members {
-		if t == "email" && m.EmailOn {
-			recipients = append(recipients, m.Email)
-		} else if t == "text" && m.TextOn {
-			recipients = append(recipients, m.TextAddr)
+		if e.Urgent == false {
+			if quiet, until := rcpt.Member.Quiet(o).Within(now); quiet {
+				c.Infof("%s is in quiet hours, deferring %s until %v", rcpt.Member.Name, e.Title, until)
+				if dryrun == false {
+					deferral := Deferral{Event: e.Key, Member: rcpt.Member.Key, Org: o.Name, Channel: t, Until: until.UTC()}
+					deferral.Save(c)
+				}
+				deferred = append(deferred, Reminder{
+					EventKey:      e.Key,
+					Title:         e.Title,
+					Org:           o.Name,
+					Offset:        "deferred",
+					Channel:       t,
+					When:          until.Truncate(time.Minute),
+					WhenFormatted: until.Format("01/02/2006 3:04pm"),
+					Recipients:    []string{rcpt.Address},
+				})
+				continue
+			}
+		}
+
+		recipients = append(recipients, rcpt.Address)
+		if SendReminder(c, clock, e, t, rcpt, dryrun) == false {
+			result = false
 		}
 	}
 
 	if len(recipients) == 0 {
 		c.Infof("No recipients, not sending reminder (" + t + ")")
-		result = true
-		return
 	}
 
-	// get rid of duplicate recipients
-	recipients = removeDuplicates(recipients)
+	return
+}
 
-	msg := &mail.Message{
-		Sender:   sender,
-		Bcc:      recipients,
-		Subject:  e.Title,
-		Body:     e.TextMessage,
-		HTMLBody: string(e.EmailMessage),
+// Send the event to a single recipient, with their own acknowledgement and
+// snooze links. The message comes from the recipient's organization and
+// its placeholders are filled in for the recipient.
+func SendReminder(c appengine.Context, clock Clock, e Event, t string, rcpt Recipient, dryrun bool) (result bool) {
+	var o = rcpt.Org
+	var appid = appengine.AppID(c)
+	var senderUserName = strings.Replace(o.Name, " ", "_", -1)
+	var sender = fmt.Sprintf("%s Reminders <%s@%s.appspotmail.com", o.Name, senderUserName, appid)
+	var vars = NewMessageVars(e, rcpt, clock.Now())
+	var unsubscribe = UnsubscribeLink(c, rcpt.Member.Key, o.Name, t)
+	var messages []*mail.Message
+
+	if t == "text" {
+		// Texts carry the message and a short link to the full version,
+		// fitted to the organization's length limit
+		link := MessageLink(c, e.Key, rcpt.Member.Key)
+		for _, part := range SMSParts(vars.SMS(e), o.SMSLimit(), o.SMSPolicy, link) {
+			messages = append(messages, &mail.Message{
+				Sender:  sender,
+				To:      []string{rcpt.Address},
+				Subject: e.Title,
+				Body:    part,
+				Headers: UnsubscribeHeaders(unsubscribe),
+			})
+		}
+	} else {
+		var gotit = AckLink(c, e.Key, rcpt.Member.Key, AckGotIt)
+		var snooze = AckLink(c, e.Key, rcpt.Member.Key, AckSnooze)
+		var location = e.Location(c)
+		var due = e.Due.In(location).Format("01/02/2006 3:04pm") + " " + location.String()
+		var body = vars.Text(e.PlainBody())
+
+		messages = append(messages, &mail.Message{
+			Sender:   sender,
+			To:       []string{rcpt.Address},
+			Subject:  e.Title,
+			Body:     fmt.Sprintf("%s\n\nDue: %s\nGot it: %s\nSnooze 1h: %s\n\nStop email reminders: %s", body, due, gotit, snooze, unsubscribe),
+			HTMLBody: fmt.Sprintf(`%s<p>Due: %s</p><p><a href="%s">Got it</a> | <a href="%s">Snooze 1 hour</a></p><p><small><a href="%s">Stop email reminders</a></small></p>`, vars.HTML(e.EmailMessage), html.EscapeString(due), html.EscapeString(gotit), html.EscapeString(snooze), html.EscapeString(unsubscribe)),
+			Headers:  UnsubscribeHeaders(unsubscribe),
+			Attachments: []mail.Attachment{
+				{Name: "event.ics", Data: EventICS(c, e, body, clock.Now())},
+			},
+		})
 	}
 
-	c.Infof("notify (%s): %v", e.Title, recipients)
-	if err := mail.Send(c, msg); err != nil {
-		c.Errorf("Couldn't send email: %v", err)
-	} else {
+	if dryrun {
+		c.Infof("dry run, not sending (%s): %v", e.Title, rcpt.Address)
 		result = true
+		return
+	}
+
+	c.Infof("notify (%s): %v", e.Title, rcpt.Address)
+	result = true
+	for _, msg := range messages {
+		if err := mail.Send(c, msg); err != nil {
+			c.Errorf("Couldn't send email: %v", err)
+			result = false
+		}
 	}
 
 	return
@@ -516,23 +1012,256 @@ func CronHandler(w http.ResponseWriter, r *http.Request) {
 	p.Events = make(map[string]Event)
 	c := appengine.NewContext(r)
 
-	events := GetAllEvents(c, true) // active only
+	// Dry runs are for checking schedule changes, admins only
+	if r.FormValue("dryrun") == "1" {
+		if u.SuperUser == false {
+			p.Error = "Access denied."
+			renderTemplate(w, "error", p)
+			return
+		}
+		p.DryRun = true
+	}
+
+	events := GetAllEvents(c, SystemClock, true) // active only
 	//c.Infof("# events to check for cron: %v", len(events))
+	var notified []string
 	for key, event := range events {
 		//c.Infof("checking event: %s", event.Title)
-		res := event.Notify(c, false)
+		res, reminders := event.Notify(c, SystemClock, false, p.DryRun)
 		if res {
-			org, _ := GetOrganizationByName(c, event.Orgs[0])
-			location, _ := time.LoadLocation(org.TimeZone)
-			event.Due = event.Due.In(location)
-			event.DueFormatted = event.Due.Format("01/02/2006 3:04pm")
-			p.Events[key] = event
+			notified = append(notified, key)
 		}
+		p.Reminders = append(p.Reminders, reminders...)
 	}
 
+	// The projection leaves out the event's own time zone
+	for key, event := range GetEventsByKey(c, notified) {
+		event.Due = event.Due.In(event.Location(c))
+		event.DueFormatted = event.Due.Format("01/02/2006 3:04pm")
+		p.Events[key] = event
+	}
+
+	// One-off reminders requested through snooze links
+	p.Reminders = append(p.Reminders, SendSnoozes(c, SystemClock, p.DryRun)...)
+
+	// Reminders held back by quiet hours
+	p.Reminders = append(p.Reminders, SendDeferred(c, SystemClock, p.DryRun)...)
+
+	// Unacknowledged reminders move up the escalation chain
+	p.Reminders = append(p.Reminders, CheckEscalations(c, SystemClock, p.DryRun)...)
+
+	// Daily and weekly digests
+	p.Reminders = append(p.Reminders, SendDigests(c, SystemClock, p.DryRun)...)
+
+	// Webhook deliveries that failed earlier
+	RetryDeliveries(c, SystemClock, p.DryRun)
+
 	renderTemplate(w, "cron", p)
 }
 
+func SimulateHandler(w http.ResponseWriter, r *http.Request) {
+	u := UserLookup(w, r)
+	p, _ := NewPage(&u)
+	c := appengine.NewContext(r)
+
+	if u.SuperUser == false {
+		p.Error = "Access denied."
+		renderTemplate(w, "error", p)
+		return
+	}
+
+	// Window defaults to the coming week, times are given in UTC
+	const longForm = "01/02/2006 3:04pm"
+	from := SystemClock.Now().UTC().Truncate(time.Minute)
+	to := from.Add(Duration_Week)
+
+	if r.FormValue("from") != "" {
+		t, timeerr := time.Parse(longForm, r.FormValue("from"))
+		if timeerr != nil {
+			p.Error = "Invalid from time, expected " + longForm
+			renderTemplate(w, "error", p)
+			return
+		}
+		from = t
+	}
+
+	if r.FormValue("to") != "" {
+		t, timeerr := time.Parse(longForm, r.FormValue("to"))
+		if timeerr != nil {
+			p.Error = "Invalid to time, expected " + longForm
+			renderTemplate(w, "error", p)
+			return
+		}
+		to = t
+	}
+
+	p.SimFrom = from.Format(longForm)
+	p.SimTo = to.Format(longForm)
+	p.Reminders = Simulate(c, from, to)
+
+	renderTemplate(w, "simulate", p)
+}
+
+// Landing page for the "got it" and "snooze" links in reminders. Members
+// are not web users, so the signed link is the only authentication.
+func AckHandler(w http.ResponseWriter, r *http.Request) {
+	p, _ := NewPage(&User{})
+	c := appengine.NewContext(r)
+
+	eventKey := r.FormValue("e")
+	memberKey := r.FormValue("m")
+	action := r.FormValue("a")
+
+	if action != AckGotIt && action != AckSnooze {
+		p.Error = "Unknown action."
+		renderTemplate(w, "error", p)
+		return
+	}
+
+	if VerifySignature(c, r.FormValue("s"), "ack", eventKey, memberKey, action) == false {
+		p.Error = "Invalid link."
+		renderTemplate(w, "error", p)
+		return
+	}
+
+	eok, event := GetEventByKey(c, eventKey)
+	mok, member := GetMemberByKey(c, memberKey)
+	if eok == false || mok == false {
+		p.Error = "Event or member not found."
+		renderTemplate(w, "error", p)
+		return
+	}
+
+	// Mail scanners follow links, so opening one only asks to confirm
+	ack := NewAck(eventKey, member, action, SystemClock.Now())
+	p.Event2Edit = event
+	if r.Method != "POST" {
+		p.Ack = Ack{MemberName: member.Name, Action: action}
+		p.Links = map[string]string{"ack": AckLink(c, eventKey, memberKey, action)}
+		renderTemplate(w, "ack", p)
+		return
+	}
+
+	if ok, _ := ack.Save(c); ok == false {
+		p.Error = "Unable to record your response, please try again."
+		renderTemplate(w, "error", p)
+		return
+	}
+
+	ack.UntilFormatted = ack.Until.In(event.Location(c)).Format("01/02/2006 3:04pm")
+
+	p.Ack = ack
+	renderTemplate(w, "ack", p)
+}
+
+// Show a member the full message of an event, for texts that were cut
+// short. Links look like /m/<event id>/<member id>/<signature>.
+func MessageHandler(w http.ResponseWriter, r *http.Request) {
+	p, _ := NewPage(&User{})
+	c := appengine.NewContext(r)
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/m/"), "/")
+	if len(parts) != 3 || verifyMessageSignature(c, parts[2], parts[0], parts[1]) == false {
+		p.Error = "Invalid link."
+		renderTemplate(w, "error", p)
+		return
+	}
+
+	eventID, _ := strconv.ParseInt(parts[0], 10, 64)
+	memberID, _ := strconv.ParseInt(parts[1], 10, 64)
+	eventKey := datastore.NewKey(c, "Event", "", eventID, nil).Encode()
+	memberKey := datastore.NewKey(c, "Member", "", memberID, nil).Encode()
+
+	eok, event := GetEventByKey(c, eventKey)
+	mok, member := GetMemberByKey(c, memberKey)
+	if eok == false || mok == false {
+		p.Error = "Event or member not found."
+		renderTemplate(w, "error", p)
+		return
+	}
+
+	// Shown as coming from the first of the event's orgs the member is in
+	rcpt := Recipient{Member: member}
+	for _, orgname := range event.Orgs {
+		for _, morg := range member.Orgs {
+			if morg == orgname {
+				rcpt.Org, _ = GetOrganizationByName(c, orgname)
+			}
+		}
+		if rcpt.Org.Name != "" {
+			break
+		}
+	}
+
+	p.Event2Edit = event
+	p.Preview = NewMessageVars(event, rcpt, SystemClock.Now()).Preview(event, rcpt.Org, "")
+	p.Links = map[string]string{
+		"gotit":  AckLink(c, eventKey, memberKey, AckGotIt),
+		"snooze": AckLink(c, eventKey, memberKey, AckSnooze),
+	}
+	if member.OrgAddress(rcpt.Org.Name, "text") != "" {
+		p.Links["stoptext"] = UnsubscribeLink(c, memberKey, rcpt.Org.Name, "text")
+	}
+	if member.OrgAddress(rcpt.Org.Name, "email") != "" {
+		p.Links["stopemail"] = UnsubscribeLink(c, memberKey, rcpt.Org.Name, "email")
+	}
+	renderTemplate(w, "message", p)
+}
+
+// Stop a member's email or text reminders from a signed link. Visiting
+// the link asks for confirmation (so link scanners don't unsubscribe
+// anyone); mail clients POST to it directly as RFC 8058 describes.
+func UnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	p, _ := NewPage(&User{})
+	c := appengine.NewContext(r)
+
+	memberKey := r.FormValue("m")
+	orgname := r.FormValue("o")
+	channel := r.FormValue("t")
+
+	if channel != "email" && channel != "text" {
+		p.Error = "Unknown channel."
+		renderTemplate(w, "error", p)
+		return
+	}
+
+	if VerifySignature(c, r.FormValue("s"), "unsubscribe", memberKey, orgname, channel) == false {
+		p.Error = "Invalid link."
+		renderTemplate(w, "error", p)
+		return
+	}
+
+	mok, member := GetMemberByKey(c, memberKey)
+	if mok == false {
+		p.Error = "Member not found."
+		renderTemplate(w, "error", p)
+		return
+	}
+
+	p.Member2Edit = member
+	p.Subscription = SubscriptionChange{Member: memberKey, Name: member.Name, Org: orgname, Channel: channel}
+	if r.Method != "POST" {
+		p.Links = map[string]string{"unsubscribe": UnsubscribeLink(c, memberKey, orgname, channel)}
+		renderTemplate(w, "unsubscribe", p)
+		return
+	}
+
+	var source = "unsubscribe link"
+	if r.PostFormValue("List-Unsubscribe") == "One-Click" {
+		source = "one-click unsubscribe from mail client"
+	}
+
+	now := SystemClock.Now()
+	if member.Unsubscribe(c, channel, orgname, source, now) == false {
+		p.Error = "Unable to unsubscribe you, please try again."
+		renderTemplate(w, "error", p)
+		return
+	}
+
+	p.Subscription.When = now
+	renderTemplate(w, "unsubscribe", p)
+}
+
 // from: https://groups.google.com/d/msg/golang-nuts/-pqkICuokio/KqJ0091EzVcJ
 func removeDuplicates(a []string) []string {
 	result := []string{}
@@ -545,3 +1274,31 @@ func removeDuplicates(a []string) []string {
 	}
 	return result
 }
+
+// Lists stored organizations whose time zone is missing or invalid.
+func TimeZoneCheckHandler(w http.ResponseWriter, r *http.Request) {
+	u := UserLookup(w, r)
+	p, _ := NewPage(&u)
+	c := appengine.NewContext(r)
+
+	if u.SuperUser == false {
+		p.Error = "Access denied."
+		renderTemplate(w, "error", p)
+		return
+	}
+
+	p.Organizations = GetInvalidTimeZoneOrgs(c)
+	renderTemplate(w, "tzcheck", p)
+}
+
+// Runs when a new instance starts, reports organizations with bad zones.
+func WarmupHandler(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+
+	for _, org := range GetInvalidTimeZoneOrgs(c) {
+		c.Warningf("Organization %s has an invalid time zone: %q", org.Name, org.TimeZone)
+	}
+
+	// Load the zone list once up front
+	TimeZones()
+}
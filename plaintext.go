@@ -0,0 +1,215 @@
+package orgreminders
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Characters allowed in a text message unless the organization says
+// otherwise, one standard SMS.
+const DefaultSMSLength = 160
+
+// Elements that start a new paragraph in the text version.
+var plainBlocks = map[string]bool{
+	"blockquote": true, "div": true, "h1": true, "h2": true, "h3": true, "h4": true,
+	"h5": true, "h6": true, "ol": true, "p": true, "pre": true, "table": true, "ul": true,
+}
+
+type plainList struct {
+	ordered bool
+	count   int
+}
+
+type plainWriter struct {
+	out     bytes.Buffer
+	newline int // line breaks owed before the next text
+	pre     bool
+	lists   []plainList
+	links   []string
+	href    string
+	anchor  int // where the current link's text starts
+}
+
+func (p *plainWriter) breakLines(n int) {
+	if n > p.newline {
+		p.newline = n
+	}
+}
+
+// Emit the line breaks owed before more text.
+func (p *plainWriter) flush() {
+	if p.out.Len() > 0 && p.newline > 0 {
+		current := p.out.String()
+		have := len(current) - len(strings.TrimRight(current, "\n"))
+		if p.newline > have {
+			p.out.WriteString(strings.Repeat("\n", p.newline-have))
+		}
+	}
+	p.newline = 0
+}
+
+// Write running text, without leading spaces at the start of a line.
+func (p *plainWriter) write(text string) {
+	p.flush()
+	if p.out.Len() == 0 || strings.HasSuffix(p.out.String(), "\n") {
+		text = strings.TrimLeft(text, " ")
+	}
+	p.out.WriteString(text)
+}
+
+// Readable plain text version of an HTML message: paragraphs separated by
+// blank lines, list items on their own lines and links numbered as
+// footnotes at the end.
+func HTMLText(h template.HTML) string {
+	var p plainWriter
+	var s = string(SanitizeHTML(string(h)))
+
+	for len(s) > 0 {
+		lt := strings.IndexByte(s, '<')
+		if lt != 0 {
+			if lt < 0 {
+				lt = len(s)
+			}
+			p.text(html.UnescapeString(s[:lt]))
+			s = s[lt:]
+			continue
+		}
+
+		gt := strings.IndexByte(s, '>')
+		if gt < 0 {
+			break
+		}
+		p.tag(s[1:gt])
+		s = s[gt+1:]
+	}
+
+	result := strings.TrimSpace(p.out.String())
+	if len(p.links) > 0 {
+		var notes []string
+		for indx, link := range p.links {
+			notes = append(notes, fmt.Sprintf("[%d] %s", indx+1, link))
+		}
+		result += "\n\n" + strings.Join(notes, "\n")
+	}
+
+	return result
+}
+
+func (p *plainWriter) text(text string) {
+	if p.pre {
+		p.flush()
+		p.out.WriteString(text)
+		return
+	}
+
+	collapsed := strings.Join(strings.Fields(text), " ")
+	if collapsed == "" {
+		// Whitespace between words still separates them
+		if text != "" && p.out.Len() > 0 && p.newline == 0 && !strings.HasSuffix(p.out.String(), " ") {
+			p.out.WriteString(" ")
+		}
+		return
+	}
+	if first, _ := utf8.DecodeRuneInString(text); unicode.IsSpace(first) {
+		collapsed = " " + collapsed
+	}
+	if last, _ := utf8.DecodeLastRuneInString(text); unicode.IsSpace(last) {
+		collapsed += " "
+	}
+	if strings.HasSuffix(p.out.String(), " ") {
+		collapsed = strings.TrimLeft(collapsed, " ")
+	}
+
+	p.write(collapsed)
+}
+
+// Handle one sanitized tag, given without its angle brackets.
+func (p *plainWriter) tag(tag string) {
+	closing := strings.HasPrefix(tag, "/")
+	name, attrs := sanitizeTagName(strings.TrimPrefix(tag, "/"))
+	attr := func(key string) string {
+		parsed, _ := sanitizeParseAttrs(attrs + ">")
+		for _, a := range parsed {
+			if a[0] == key {
+				return a[1]
+			}
+		}
+		return ""
+	}
+
+	switch {
+	case name == "br":
+		p.out.WriteString("\n")
+		p.newline = 0
+	case name == "hr":
+		p.breakLines(2)
+		p.write("----------")
+		p.breakLines(2)
+	case name == "img":
+		p.write(attr("alt"))
+	case name == "pre":
+		p.pre = !closing
+		p.breakLines(2)
+	case name == "ul" || name == "ol":
+		if closing {
+			if len(p.lists) > 0 {
+				p.lists = p.lists[:len(p.lists)-1]
+			}
+		} else {
+			start, err := strconv.Atoi(attr("start"))
+			if err != nil {
+				start = 1
+			}
+			p.lists = append(p.lists, plainList{ordered: name == "ol", count: start - 1})
+		}
+		if len(p.lists) > 0 {
+			p.breakLines(1)
+		} else {
+			p.breakLines(2)
+		}
+	case name == "li":
+		p.breakLines(1)
+		if closing || len(p.lists) == 0 {
+			return
+		}
+		list := &p.lists[len(p.lists)-1]
+		marker := "- "
+		if list.ordered {
+			list.count++
+			marker = strconv.Itoa(list.count) + ". "
+		}
+		p.flush()
+		p.out.WriteString(strings.Repeat("  ", len(p.lists)-1) + marker)
+	case name == "tr":
+		p.breakLines(1)
+	case (name == "td" || name == "th") && !closing:
+		if !strings.HasSuffix(p.out.String(), "\n") && p.newline == 0 {
+			p.out.WriteString("  ")
+		}
+	case name == "a":
+		if !closing {
+			p.href = attr("href")
+			p.flush()
+			p.anchor = p.out.Len()
+			return
+		}
+		if p.href == "" {
+			return
+		}
+		label := strings.TrimSpace(p.out.String()[p.anchor:])
+		target := strings.TrimPrefix(p.href, "mailto:")
+		if label != target && label != p.href {
+			p.links = append(p.links, p.href)
+			p.write(fmt.Sprintf(" [%d]", len(p.links)))
+		}
+		p.href = ""
+	case plainBlocks[name]:
+		p.breakLines(2)
+	}
+}
@@ -0,0 +1,50 @@
+package orgreminders
+
+import (
+	"html/template"
+	"testing"
+)
+
+func TestHTMLText(t *testing.T) {
+	var tests = []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"empty", "", ""},
+		{"paragraphs", "<p>One\n  two</p><p>Three</p>", "One two\n\nThree"},
+		{"inline markup", "Hello <b>there</b> you", "Hello there you"},
+		{"heading", "<h2>Agenda</h2><p>Items</p>", "Agenda\n\nItems"},
+		{"line break", "a<br>b", "a\nb"},
+		{"rule", "<p>a</p><hr><p>b</p>", "a\n\n----------\n\nb"},
+		{"blockquote", "<blockquote>quoted</blockquote><p>reply</p>", "quoted\n\nreply"},
+		{"table", "<table><tr><th>A</th><th>B</th></tr><tr><td>1</td><td>2</td></tr></table>", "A  B\n1  2"},
+		{"image alt", `<p><img src="https://example.com/i.png" alt="logo"> text</p>`, "logo text"},
+		{"script dropped", "<p>a<script>alert(1)</script>b</p>", "ab"},
+
+		{"list", "<ul><li>one</li><li>two</li></ul><p>after</p>", "- one\n- two\n\nafter"},
+		{"nested list", "<ul><li>one</li><li>two<ul><li>nested</li></ul></li><li>three</li></ul>", "- one\n- two\n  - nested\n- three"},
+		{"ordered list", "<ol><li>a</li><li>b</li></ol>", "1. a\n2. b"},
+		{"ordered list start", `<ol start="3"><li>c</li><li>d</li></ol>`, "3. c\n4. d"},
+		{"bad start", `<ol start="x"><li>a</li></ol>`, "1. a"},
+		{"nested ordered", "<ol><li>a<ol><li>a1</li><li>a2</li></ol></li><li>b</li></ol>", "1. a\n  1. a1\n  2. a2\n2. b"},
+
+		{"links", `<p>See <a href="https://example.com/a">the agenda</a> and <a href="https://example.com/b">minutes</a>.</p>`, "See the agenda [1] and minutes [2].\n\n[1] https://example.com/a\n[2] https://example.com/b"},
+		{"label is url", `<p><a href="https://example.com/">https://example.com/</a></p>`, "https://example.com/"},
+		{"mailto label is address", `<p>Mail <a href="mailto:a@example.com">a@example.com</a></p>`, "Mail a@example.com"},
+		{"mailto with label", `<p>Mail <a href="mailto:b@example.com">Bob</a></p>`, "Mail Bob [1]\n\n[1] mailto:b@example.com"},
+		{"unsafe link", `<p><a href="javascript:alert(1)">x</a></p>`, "x"},
+
+		{"pre", "<pre>line 1\n  indented\n\nline 4</pre><p>after</p>", "line 1\n  indented\n\nline 4\n\nafter"},
+		{"pre markup", "<pre>a <b>b</b> &lt;c&gt;</pre>", "a b <c>"},
+
+		{"entities", "<p>Fish &amp; chips &lt;3 &quot;q&quot; &eacute; &#8364; &#x41;</p>", `Fish & chips <3 "q" é € A`},
+		{"nbsp", "<p>a&nbsp;&nbsp;b</p>", "a b"},
+	}
+
+	for _, test := range tests {
+		if got := HTMLText(template.HTML(test.in)); got != test.want {
+			t.Errorf("%s: HTMLText(%q) = %q, want %q", test.name, test.in, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package orgreminders
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"time"
+)
+
+// Layout of quiet hour boundaries, 24 hour wall clock.
+const QuietLayout = "15:04"
+
+// A daily window in which non-urgent reminders are held back. The window
+// wraps past midnight when End is earlier than Start, e.g. 22:00 - 07:00.
+type QuietHours struct {
+	Start string
+	End   string
+}
+
+// Whether the window is configured at all.
+func (q QuietHours) Active() bool {
+	return q.Start != "" && q.End != "" && q.Start != q.End
+}
+
+// Check that both boundaries are valid times of day (or both empty).
+func (q QuietHours) Valid() bool {
+	if q.Start == "" && q.End == "" {
+		return true
+	}
+
+	_, serr := time.Parse(QuietLayout, q.Start)
+	_, eerr := time.Parse(QuietLayout, q.End)
+	return serr == nil && eerr == nil
+}
+
+// Report whether t falls inside the window and, if so, when the window
+// ends. Both are computed on the wall clock of t's location.
+func (q QuietHours) Within(t time.Time) (bool, time.Time) {
+	if q.Active() == false {
+		return false, t
+	}
+
+	start, serr := time.Parse(QuietLayout, q.Start)
+	end, eerr := time.Parse(QuietLayout, q.End)
+	if serr != nil || eerr != nil {
+		return false, t
+	}
+
+	var loc = t.Location()
+	var startToday = time.Date(t.Year(), t.Month(), t.Day(), start.Hour(), start.Minute(), 0, 0, loc)
+	var endToday = time.Date(t.Year(), t.Month(), t.Day(), end.Hour(), end.Minute(), 0, 0, loc)
+
+	if startToday.Before(endToday) {
+		// Same day window
+		if !t.Before(startToday) && t.Before(endToday) {
+			return true, endToday
+		}
+		return false, t
+	}
+
+	// Window wraps past midnight
+	if t.Before(endToday) {
+		return true, endToday
+	}
+	if !t.Before(startToday) {
+		return true, time.Date(t.Year(), t.Month(), t.Day()+1, end.Hour(), end.Minute(), 0, 0, loc)
+	}
+
+	return false, t
+}
+
+// A reminder held back by quiet hours, delivered once Until has passed.
+type Deferral struct {
+	Key     string `datastore:"-"`
+	Event   string
+	Member  string
+	Org     string
+	Channel string
+	Until   time.Time
+	Sent    bool
+}
+
+// Deferrals are keyed by event, member and channel, so that several
+// reminders held back in one quiet window go out as one.
+func deferralKey(c appengine.Context, d Deferral) *datastore.Key {
+	return datastore.NewKey(c, "Deferral", d.Event+"/"+d.Member+"/"+d.Channel, 0, nil)
+}
+
+// Save a deferral to the database, replacing any for the same event,
+// member and channel
+func (d Deferral) Save(c appengine.Context) bool {
+	_, err := datastore.Put(c, deferralKey(c, d), &d)
+	if err != nil {
+		c.Errorf("Deferral.Save error: %v", err)
+		return false
+	}
+
+	return true
+}
+
+func (d Deferral) Update(c appengine.Context) bool {
+	keyObj, decerr := datastore.DecodeKey(d.Key)
+	if decerr != nil {
+		c.Infof("Invalid key specified")
+		return false
+	}
+
+	_, err := datastore.Put(c, keyObj, &d)
+	if err != nil {
+		c.Errorf("Deferral.Update error: %v", err)
+		return false
+	}
+
+	return true
+}
+
+// Deferrals whose quiet hours are over and have not been sent yet.
+func GetDueDeferrals(c appengine.Context, clock Clock) []Deferral {
+	var dbResults []Deferral
+	var result = []Deferral{}
+
+	q := datastore.NewQuery("Deferral").Filter("Sent = ", false)
+	keys, err := q.GetAll(c, &dbResults)
+	if err != nil {
+		c.Infof("GetDueDeferrals DB lookup error: %v", err)
+	}
+
+	for indx, deferral := range dbResults {
+		if deferral.Until.After(clock.Now()) {
+			continue
+		}
+		deferral.Key = keys[indx].Encode()
+		result = append(result, deferral)
+	}
+
+	return result
+}
+
+// Deliver the reminders that were held back by quiet hours.
+func SendDeferred(c appengine.Context, clock Clock, dryrun bool) (reminders Reminders) {
+	for _, deferral := range GetDueDeferrals(c, clock) {
+		reminders = append(reminders, SendDeferral(c, clock, deferral, dryrun)...)
+	}
+
+	return
+}
+
+// Send a single held back reminder and mark it sent.
+func SendDeferral(c appengine.Context, clock Clock, deferral Deferral, dryrun bool) (reminders Reminders) {
+	okay, event := GetEventByKey(c, deferral.Event)
+	mok, member := GetMemberByKey(c, deferral.Member)
+	o, oerr := GetOrganizationByName(c, deferral.Org)
+	if okay != true || mok != true || oerr != nil {
+		c.Infof("SendDeferred: Error querying for event %s, member %s or org %s", deferral.Event, deferral.Member, deferral.Org)
+		return
+	}
+
+	// Skip anyone who acknowledged in the meantime
+	var addr = member.OrgAddress(o.Name, deferral.Channel)
+	if addr != "" && AckedMembers(c, event.Key)[member.Key] == false {
+		ok := SendReminder(c, clock, event, deferral.Channel, Recipient{Member: member, Address: addr, Org: o}, dryrun)
+
+		var now = clock.Now().In(event.Location(c))
+		reminder := Reminder{
+			EventKey:      event.Key,
+			Title:         event.Title,
+			Org:           o.Name,
+			Offset:        "deferred",
+			Channel:       deferral.Channel,
+			When:          now.Truncate(time.Minute),
+			WhenFormatted: now.Format("01/02/2006 3:04pm"),
+			Recipients:    []string{addr},
+		}
+		reminders = append(reminders, reminder)
+		if dryrun == false {
+			FireReminderWebhook(c, clock, []string{o.Name}, reminder, ok)
+		}
+	}
+
+	if dryrun == false {
+		deferral.Sent = true
+		deferral.Update(c)
+	}
+
+	return
+}
@@ -0,0 +1,80 @@
+package orgreminders
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuietHoursWithin(t *testing.T) {
+	var day = func(d, h, m int) time.Time {
+		return time.Date(2014, 3, d, h, m, 0, 0, time.UTC)
+	}
+
+	var tests = []struct {
+		name  string
+		quiet QuietHours
+		at    time.Time
+		in    bool
+		until time.Time
+	}{
+		{"overnight evening", QuietHours{"22:00", "07:00"}, day(10, 23, 30), true, day(11, 7, 0)},
+		{"overnight morning", QuietHours{"22:00", "07:00"}, day(11, 3, 0), true, day(11, 7, 0)},
+		{"overnight midnight", QuietHours{"22:00", "07:00"}, day(11, 0, 0), true, day(11, 7, 0)},
+		{"overnight start", QuietHours{"22:00", "07:00"}, day(10, 22, 0), true, day(11, 7, 0)},
+		{"overnight before start", QuietHours{"22:00", "07:00"}, day(10, 21, 59), false, day(10, 21, 59)},
+		{"overnight before end", QuietHours{"22:00", "07:00"}, day(11, 6, 59), true, day(11, 7, 0)},
+		{"overnight end", QuietHours{"22:00", "07:00"}, day(11, 7, 0), false, day(11, 7, 0)},
+		{"overnight daytime", QuietHours{"22:00", "07:00"}, day(11, 12, 0), false, day(11, 12, 0)},
+		{"overnight month end", QuietHours{"22:00", "07:00"}, time.Date(2014, 3, 31, 23, 0, 0, 0, time.UTC), true, time.Date(2014, 4, 1, 7, 0, 0, 0, time.UTC)},
+
+		{"same day inside", QuietHours{"12:00", "13:30"}, day(10, 12, 45), true, day(10, 13, 30)},
+		{"same day start", QuietHours{"12:00", "13:30"}, day(10, 12, 0), true, day(10, 13, 30)},
+		{"same day end", QuietHours{"12:00", "13:30"}, day(10, 13, 30), false, day(10, 13, 30)},
+		{"same day before", QuietHours{"12:00", "13:30"}, day(10, 11, 59), false, day(10, 11, 59)},
+
+		{"equal start and end", QuietHours{"07:00", "07:00"}, day(10, 7, 0), false, day(10, 7, 0)},
+		{"not configured", QuietHours{}, day(10, 23, 0), false, day(10, 23, 0)},
+		{"half configured", QuietHours{"22:00", ""}, day(10, 23, 0), false, day(10, 23, 0)},
+		{"invalid", QuietHours{"late", "07:00"}, day(10, 23, 0), false, day(10, 23, 0)},
+	}
+
+	for _, test := range tests {
+		in, until := test.quiet.Within(test.at)
+		if in != test.in || !until.Equal(test.until) {
+			t.Errorf("%s: %v-%v Within(%v) = %v, %v; want %v, %v", test.name, test.quiet.Start, test.quiet.End, test.at, in, until, test.in, test.until)
+		}
+	}
+}
+
+func TestQuietHoursWithinDST(t *testing.T) {
+	chicago, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Skip("no time zone data")
+	}
+
+	// The night the clocks go forward the window still ends at 07:00
+	var quiet = QuietHours{"22:00", "07:00"}
+	in, until := quiet.Within(time.Date(2014, 3, 8, 23, 0, 0, 0, chicago))
+	if want := time.Date(2014, 3, 9, 7, 0, 0, 0, chicago); !in || !until.Equal(want) {
+		t.Errorf("Within across DST = %v, %v; want true, %v", in, until, want)
+	}
+}
+
+func TestQuietHoursValid(t *testing.T) {
+	var tests = []struct {
+		quiet QuietHours
+		want  bool
+	}{
+		{QuietHours{}, true},
+		{QuietHours{"22:00", "07:00"}, true},
+		{QuietHours{"22:00", ""}, false},
+		{QuietHours{"10pm", "07:00"}, false},
+		{QuietHours{"24:00", "07:00"}, false},
+	}
+
+	for _, test := range tests {
+		if got := test.quiet.Valid(); got != test.want {
+			t.Errorf("%+v.Valid() = %v, want %v", test.quiet, got, test.want)
+		}
+	}
+}
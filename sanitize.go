@@ -0,0 +1,360 @@
+package orgreminders
+
+import (
+	"bytes"
+	"html"
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+// Elements kept by SanitizeHTML, with the attributes allowed on each.
+// Every allowed element may also carry a (filtered) style and a title.
+var sanitizeElements = map[string][]string{
+	"a":          {"href", "target"},
+	"b":          nil,
+	"blockquote": nil,
+	"br":         nil,
+	"code":       nil,
+	"del":        nil,
+	"div":        {"align"},
+	"em":         nil,
+	"font":       {"color", "face", "size"},
+	"h1":         {"align"},
+	"h2":         {"align"},
+	"h3":         {"align"},
+	"h4":         {"align"},
+	"h5":         {"align"},
+	"h6":         {"align"},
+	"hr":         nil,
+	"i":          nil,
+	"img":        {"src", "alt", "width", "height", "align"},
+	"ins":        nil,
+	"li":         nil,
+	"ol":         {"start"},
+	"p":          {"align"},
+	"pre":        nil,
+	"s":          nil,
+	"span":       nil,
+	"strike":     nil,
+	"strong":     nil,
+	"sub":        nil,
+	"sup":        nil,
+	"table":      {"border", "cellpadding", "cellspacing", "width", "align"},
+	"tbody":      nil,
+	"td":         {"colspan", "rowspan", "width", "align", "valign"},
+	"tfoot":      nil,
+	"th":         {"colspan", "rowspan", "width", "align", "valign"},
+	"thead":      nil,
+	"tr":         nil,
+	"u":          nil,
+	"ul":         nil,
+}
+
+// Elements without an end tag.
+var sanitizeVoid = map[string]bool{"br": true, "hr": true, "img": true}
+
+// Elements dropped along with everything inside them.
+var sanitizeDropContent = map[string]bool{
+	"applet": true, "embed": true, "frameset": true, "head": true, "iframe": true,
+	"math": true, "noembed": true, "noframes": true, "noscript": true, "object": true,
+	"script": true, "style": true, "svg": true, "template": true, "textarea": true,
+	"title": true, "xmp": true,
+}
+
+// CSS properties allowed in style attributes.
+var sanitizeStyles = map[string]bool{
+	"background-color": true, "border": true, "border-collapse": true, "color": true,
+	"font-family": true, "font-size": true, "font-style": true, "font-weight": true,
+	"height": true, "margin": true, "margin-left": true, "margin-right": true,
+	"padding": true, "padding-left": true, "padding-right": true, "text-align": true,
+	"text-decoration": true, "vertical-align": true, "width": true,
+}
+
+var reStyleValue = regexp.MustCompile(`^[-#\w\s.,%()'"!]*$`)
+
+// Clean up user supplied HTML so it is safe to show to other users and to
+// send in mail. Anything not on the allowlist above is dropped: unknown
+// elements keep their text, script-like elements lose their content too,
+// and only http(s)/mailto links and http(s) images survive. Unclosed
+// elements are closed at the end.
+func SanitizeHTML(s string) template.HTML {
+	var out bytes.Buffer
+	var open []string
+
+	for len(s) > 0 {
+		lt := strings.IndexByte(s, '<')
+		if lt < 0 {
+			out.WriteString(sanitizeText(s))
+			break
+		}
+		out.WriteString(sanitizeText(s[:lt]))
+		s = s[lt:]
+
+		switch {
+		case strings.HasPrefix(s, "<!--"):
+			// Comments, including IE conditional ones
+			end := strings.Index(s[4:], "-->")
+			if end < 0 {
+				return template.HTML(out.String() + sanitizeClose(open))
+			}
+			s = s[4+end+3:]
+
+		case len(s) > 1 && (s[1] == '!' || s[1] == '?'):
+			// Doctypes, CDATA and processing instructions
+			end := strings.IndexByte(s, '>')
+			if end < 0 {
+				return template.HTML(out.String() + sanitizeClose(open))
+			}
+			s = s[end+1:]
+
+		case len(s) > 2 && s[1] == '/' && isASCIILetter(s[2]):
+			name, rest := sanitizeTagName(s[2:])
+			end := strings.IndexByte(rest, '>')
+			if end < 0 {
+				rest = ""
+			} else {
+				rest = rest[end+1:]
+			}
+			s = rest
+
+			// Only close elements that are actually open
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] == name {
+					for j := len(open) - 1; j >= i; j-- {
+						out.WriteString("</" + open[j] + ">")
+					}
+					open = open[:i]
+					break
+				}
+			}
+
+		case len(s) > 1 && isASCIILetter(s[1]):
+			name, rest := sanitizeTagName(s[1:])
+			attrs, rest := sanitizeParseAttrs(rest)
+			s = rest
+
+			if sanitizeDropContent[name] {
+				s = sanitizeSkipElement(s, name)
+				continue
+			}
+
+			allowed, ok := sanitizeElements[name]
+			if !ok {
+				continue
+			}
+
+			out.WriteString("<" + name)
+			var blank bool
+			for _, attr := range attrs {
+				value, keep := sanitizeAttr(name, allowed, attr[0], attr[1])
+				if keep {
+					out.WriteString(" " + attr[0] + `="` + html.EscapeString(value) + `"`)
+					blank = blank || (attr[0] == "target" && value == "_blank")
+				}
+			}
+			if blank {
+				out.WriteString(` rel="noopener noreferrer"`)
+			}
+			out.WriteString(">")
+
+			if !sanitizeVoid[name] {
+				open = append(open, name)
+			}
+
+		default:
+			// A lone "<" is just text
+			out.WriteString("&lt;")
+			s = s[1:]
+		}
+	}
+
+	out.WriteString(sanitizeClose(open))
+	return template.HTML(out.String())
+}
+
+// Re-escape text so stray markup characters cannot form tags.
+func sanitizeText(s string) string {
+	return html.EscapeString(html.UnescapeString(s))
+}
+
+// End tags for everything still open, innermost first.
+func sanitizeClose(open []string) string {
+	var result string
+
+	for i := len(open) - 1; i >= 0; i-- {
+		result += "</" + open[i] + ">"
+	}
+
+	return result
+}
+
+func isASCIILetter(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+// Split a lowercased tag name off the front of s.
+func sanitizeTagName(s string) (string, string) {
+	i := 0
+	for i < len(s) && !strings.ContainsRune(" \t\n\r\f/>", rune(s[i])) {
+		i++
+	}
+
+	return strings.ToLower(s[:i]), s[i:]
+}
+
+// Parse the attributes of a start tag up to and including its ">". Names
+// are lowercased and values are unescaped.
+func sanitizeParseAttrs(s string) (attrs [][2]string, rest string) {
+	for {
+		s = strings.TrimLeft(s, " \t\n\r\f/")
+		if s == "" {
+			return attrs, ""
+		}
+		if s[0] == '>' {
+			return attrs, s[1:]
+		}
+
+		i := 0
+		for i < len(s) && !strings.ContainsRune(" \t\n\r\f/>=", rune(s[i])) {
+			i++
+		}
+		if i == 0 {
+			// A stray "=" where a name should be
+			i = 1
+		}
+		name := strings.ToLower(s[:i])
+		s = strings.TrimLeft(s[i:], " \t\n\r\f")
+
+		var value string
+		if strings.HasPrefix(s, "=") {
+			s = strings.TrimLeft(s[1:], " \t\n\r\f")
+			if s != "" && (s[0] == '"' || s[0] == '\'') {
+				end := strings.IndexByte(s[1:], s[0])
+				if end < 0 {
+					return attrs, ""
+				}
+				value = s[1 : end+1]
+				s = s[end+2:]
+			} else {
+				j := 0
+				for j < len(s) && !strings.ContainsRune(" \t\n\r\f>", rune(s[j])) {
+					j++
+				}
+				value = s[:j]
+				s = s[j:]
+			}
+		}
+
+		attrs = append(attrs, [2]string{name, html.UnescapeString(value)})
+	}
+}
+
+// Skip past the end tag of an element whose content is dropped.
+func sanitizeSkipElement(s string, name string) string {
+	// Byte by byte, so offsets into lower are offsets into s
+	buf := []byte(s)
+	for i, b := range buf {
+		if b >= 'A' && b <= 'Z' {
+			buf[i] = b + ('a' - 'A')
+		}
+	}
+	lower := string(buf)
+
+	for offset := 0; ; {
+		i := strings.Index(lower[offset:], "</"+name)
+		if i < 0 {
+			return ""
+		}
+		i += offset
+
+		after := i + 2 + len(name)
+		if after >= len(lower) || strings.ContainsRune(" \t\n\r\f/>", rune(lower[after])) {
+			end := strings.IndexByte(lower[after:], '>')
+			if end < 0 {
+				return ""
+			}
+			return s[after+end+1:]
+		}
+		offset = after
+	}
+}
+
+// Whether an attribute survives, and its cleaned value.
+func sanitizeAttr(element string, allowed []string, name string, value string) (string, bool) {
+	switch name {
+	case "style":
+		value = sanitizeStyle(value)
+		return value, value != ""
+	case "title":
+		return value, true
+	}
+
+	var found bool
+	for _, a := range allowed {
+		found = found || a == name
+	}
+	if !found {
+		return "", false
+	}
+
+	switch name {
+	case "href":
+		return value, sanitizeURL(value, "http", "https", "mailto")
+	case "src":
+		return value, sanitizeURL(value, "http", "https")
+	case "target":
+		return value, value == "_blank" || value == "_self"
+	}
+
+	return value, reStyleValue.MatchString(value)
+}
+
+// Whether a URL is relative or uses one of the given schemes.
+func sanitizeURL(value string, schemes ...string) bool {
+	// Browsers ignore control characters and whitespace in schemes
+	var clean = strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, strings.ToLower(value))
+
+	colon := strings.IndexByte(clean, ':')
+	if colon < 0 || strings.IndexAny(clean[:colon], "/?#") >= 0 {
+		// No scheme, e.g. "#top" or "/events"
+		return true
+	}
+
+	for _, scheme := range schemes {
+		if clean[:colon] == scheme {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Keep only allowlisted CSS properties with plain values.
+func sanitizeStyle(style string) string {
+	var result []string
+
+	for _, decl := range strings.Split(style, ";") {
+		parts := strings.SplitN(decl, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		prop := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+		lower := strings.ToLower(value)
+		if !sanitizeStyles[prop] || !reStyleValue.MatchString(value) ||
+			strings.Contains(lower, "url") || strings.Contains(lower, "expression") {
+			continue
+		}
+
+		result = append(result, prop+": "+value)
+	}
+
+	return strings.Join(result, "; ")
+}
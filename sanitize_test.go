@@ -0,0 +1,83 @@
+package orgreminders
+
+import (
+	"html/template"
+	"testing"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	var tests = []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain text", "Bring snacks & drinks", "Bring snacks &amp; drinks"},
+		{"allowed markup", `<p align="center">Hi <b>there</b></p>`, `<p align="center">Hi <b>there</b></p>`},
+		{"unclosed element", "<p>Hi <em>there", "<p>Hi <em>there</em></p>"},
+		{"stray end tag", "Hi</b> there", "Hi there"},
+		{"lone angle bracket", "1 < 2", "1 &lt; 2"},
+		{"comment", "a<!-- <script>alert(1)</script> -->b", "ab"},
+
+		{"script", "a<script>alert(1)</script>b", "ab"},
+		{"script mixed case", "a<ScRiPt>alert(1)</sCrIpT>b", "ab"},
+		{"script end tag with space", "a<script>alert(1)</script >b", "ab"},
+		{"script unclosed", "a<script>alert(1)", "a"},
+		{"script after non-ASCII", "İİİ<SCRIPT>alert(1)</SCRIPT>b", "İİİb"},
+		{"style", "a<style>body { color: red }</style>b", "ab"},
+		{"iframe", `a<iframe src="https://example.com/"></iframe>b`, "ab"},
+		{"unknown element keeps text", "<marquee>hi</marquee>", "hi"},
+
+		{"onclick", `<b onclick="alert(1)">x</b>`, "<b>x</b>"},
+		{"onerror", `<img src="https://example.com/a.png" onerror="alert(1)">`, `<img src="https://example.com/a.png">`},
+		{"onmouseover unquoted", `<a href="/x" onmouseover=alert(1)>x</a>`, `<a href="/x">x</a>`},
+		{"attribute not allowed", `<p id="x" class="y">x</p>`, "<p>x</p>"},
+
+		{"https link", `<a href="https://example.com/?a=1&amp;b=2">x</a>`, `<a href="https://example.com/?a=1&amp;b=2">x</a>`},
+		{"mailto link", `<a href="mailto:a@example.com">x</a>`, `<a href="mailto:a@example.com">x</a>`},
+		{"relative link", `<a href="/events#top">x</a>`, `<a href="/events#top">x</a>`},
+		{"javascript link", `<a href="javascript:alert(1)">x</a>`, "<a>x</a>"},
+		{"javascript mixed case", `<a href="JaVaScRiPt:alert(1)">x</a>`, "<a>x</a>"},
+		{"javascript with whitespace", "<a href=\" java\tscript:alert(1)\">x</a>", "<a>x</a>"},
+		{"javascript entity encoded", `<a href="&#106;avascript:alert(1)">x</a>`, "<a>x</a>"},
+		{"javascript hex entity", `<a href="jav&#x61;script:alert(1)">x</a>`, "<a>x</a>"},
+		{"javascript entity colon", `<a href="javascript&colon;alert(1)">x</a>`, "<a>x</a>"},
+		{"javascript entity tab", `<a href="java&#9;script:alert(1)">x</a>`, "<a>x</a>"},
+		{"vbscript link", `<a href="vbscript:msgbox(1)">x</a>`, "<a>x</a>"},
+		{"data link", `<a href="data:text/html;base64,PHNjcmlwdD4=">x</a>`, "<a>x</a>"},
+		{"data image", `<img src="DATA:image/svg+xml,<svg onload=alert(1)>">`, "<img>"},
+		{"mailto image", `<img src="mailto:a@example.com">`, "<img>"},
+
+		{"target blank", `<a href="/x" target="_blank">x</a>`, `<a href="/x" target="_blank" rel="noopener noreferrer">x</a>`},
+		{"style filtered", `<p style="color: red; position: fixed">x</p>`, `<p style="color: red">x</p>`},
+		{"style url", `<p style="background-color: url(javascript:alert(1))">x</p>`, "<p>x</p>"},
+		{"style expression", `<p style="width: expression(alert(1))">x</p>`, "<p>x</p>"},
+		{"attribute breakout", `<p title='"><script>alert(1)</script>'>x</p>`, `<p title="&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;">x</p>`},
+	}
+
+	for _, test := range tests {
+		if got := string(SanitizeHTML(test.in)); got != test.want {
+			t.Errorf("%s: SanitizeHTML(%q) = %q, want %q", test.name, test.in, got, test.want)
+		}
+	}
+}
+
+func TestMessageVarsHTML(t *testing.T) {
+	var tests = []struct {
+		name string
+		in   string
+		vars MessageVars
+		want string
+	}{
+		{"text", "<p>Hi {{name}}</p>", MessageVars{Name: "<b>Ann</b>"}, "<p>Hi &lt;b&gt;Ann&lt;/b&gt;</p>"},
+		{"javascript in link", `<a href="{{title}}">x</a>`, MessageVars{Title: "javascript:alert(1)"}, "<a>x</a>"},
+		{"javascript in image", `<img src="{{org}}">`, MessageVars{Org: "JavaScript:alert(1)"}, "<img>"},
+		{"quote breakout", `<a href="/x?{{name}}">x</a>`, MessageVars{Name: `" onclick="alert(1)`}, `<a href="/x?&#34; onclick=&#34;alert(1)">x</a>`},
+		{"https link", `<a href="https://example.com/{{org}}">x</a>`, MessageVars{Org: "Ops"}, `<a href="https://example.com/Ops">x</a>`},
+	}
+
+	for _, test := range tests {
+		if got := string(test.vars.HTML(template.HTML(test.in))); got != test.want {
+			t.Errorf("%s: HTML(%q) = %q, want %q", test.name, test.in, got, test.want)
+		}
+	}
+}
@@ -3,10 +3,25 @@ package orgreminders
 import (
 	"fmt"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// Marks a Schedule.When entry as an absolute time rather than an offset.
+const AbsolutePrefix = "@"
+
+// Layout of absolute Schedule.When entries. These are wall clock times in
+// the organization's time zone, e.g. "@2014-10-06 09:00".
+const AbsoluteLayout = "2006-01-02 15:04"
+
+// Marks a Schedule.When offset as a follow-up after the due time, e.g. "+1d".
+const FollowUpPrefix = "+"
+
+// How far back active event lookups reach so that follow-ups can still fire.
+var FollowUpWindow = 8 * 7 * 24 * time.Hour
+
 type Schedule struct {
 	Name string
 	When []string
@@ -35,16 +50,39 @@ func (s *Schedule) Del(when string) {
 	s.When = newWhen
 }
 
-// Return times (in current Locale) of the whole schedule.
-func (s *Schedule) Times(baseTime time.Time) map[string]time.Time {
+// Return times (in current Locale) of the whole schedule. Absolute entries
+// are read as wall clock times in baseTime's location. Day, week and
+// business day ("bd") offsets are calendar offsets in that location, so
+// they keep the wall clock time across DST changes; business days also
+// skip the non-working days of cal.
+func (s *Schedule) Times(baseTime time.Time, cal Calendar) map[string]time.Time {
 	var times = make(map[string]time.Time)
 	var timeNil = time.Date(0, 0, 0, 0, 0, 0, 0, time.UTC)
 	reI := regexp.MustCompile(`\d+`)
-	reS := regexp.MustCompile(`\D`)
+	reS := regexp.MustCompile(`\D+`)
 	for _, val := range s.When {
+		if strings.HasPrefix(val, AbsolutePrefix) {
+			absTime, err := time.ParseInLocation(AbsoluteLayout, val[len(AbsolutePrefix):], baseTime.Location())
+			if err != nil {
+				fmt.Println("ERR: cannot parse absolute time " + val + "... skipping")
+				continue
+			}
+
+			times[val] = absTime
+			continue
+		}
+
+		// Offsets count back from baseTime, follow-ups count forward
 		var valTime = baseTime
-		var unitVal = reS.FindString(val)
-		var offsetVal = reI.FindString(val)
+		var direction = time.Duration(-1)
+		var offset = val
+		if strings.HasPrefix(offset, FollowUpPrefix) {
+			direction = 1
+			offset = offset[len(FollowUpPrefix):]
+		}
+
+		var unitVal = reS.FindString(offset)
+		var offsetVal = reI.FindString(offset)
 
 		// Get our integer offset value
 		intVal, err := strconv.Atoi(offsetVal)
@@ -55,13 +93,16 @@ func (s *Schedule) Times(baseTime time.Time) map[string]time.Time {
 		intValD := time.Duration(intVal)
 
 		if unitVal == "m" {
-			valTime = valTime.Add(-1 * intValD * time.Minute)
+			valTime = valTime.Add(direction * intValD * time.Minute)
 		} else if unitVal == "h" {
-			valTime = valTime.Add(-1 * intValD * time.Hour)
+			valTime = valTime.Add(direction * intValD * time.Hour)
 		} else if unitVal == "d" {
-			valTime = valTime.Add(-24 * intValD * time.Hour)
+			// Calendar days keep the wall clock time across DST changes
+			valTime = valTime.AddDate(0, 0, int(direction)*intVal)
 		} else if unitVal == "w" {
-			valTime = valTime.Add(-168 * intValD * time.Hour)
+			valTime = valTime.AddDate(0, 0, int(direction)*7*intVal)
+		} else if unitVal == "bd" {
+			valTime = cal.AddBusinessDays(valTime, int(direction)*intVal)
 		} else {
 			valTime = timeNil
 		}
@@ -72,16 +113,90 @@ func (s *Schedule) Times(baseTime time.Time) map[string]time.Time {
 	return times
 }
 
-// Get schedule in usable format for HTML
+var reWhen = regexp.MustCompile(`^\+?\d+(m|h|d|w|bd)$`)
+
+// Whether val is a well formed Schedule.When entry.
+func ValidWhen(val string) bool {
+	if strings.HasPrefix(val, AbsolutePrefix) {
+		_, err := time.Parse(AbsoluteLayout, val[len(AbsolutePrefix):])
+		return err == nil
+	}
+
+	return reWhen.MatchString(val)
+}
+
+// Entries of the schedule that are not well formed.
+func (s *Schedule) Invalid() []string {
+	var result = []string{}
+
+	for _, val := range s.When {
+		if ValidWhen(val) == false {
+			result = append(result, val)
+		}
+	}
+
+	return result
+}
+
+// Entries of the schedule that fire more than FollowUpWindow after
+// baseTime. Active event lookups stop reaching back before then, so these
+// would never be sent.
+func (s *Schedule) TooLate(baseTime time.Time, cal Calendar) []string {
+	var result = []string{}
+
+	for val, valTime := range s.Times(baseTime, cal) {
+		if valTime.Sub(baseTime) > FollowUpWindow {
+			result = append(result, val)
+		}
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+// Largest amount of time after baseTime that the schedule still fires.
+func (s *Schedule) FollowUp(baseTime time.Time, cal Calendar) time.Duration {
+	var result time.Duration
+
+	for _, valTime := range s.Times(baseTime, cal) {
+		if valTime.Sub(baseTime) > result {
+			result = valTime.Sub(baseTime)
+		}
+	}
+
+	return result
+}
+
+// Get schedule in usable format for HTML: offset, unit and (for absolute
+// entries) the time in the same layout as the Due field.
 func (s *Schedule) HTML() map[string][]string {
 	var result = make(map[string][]string)
 
 	reI := regexp.MustCompile(`\d+`)
-	reS := regexp.MustCompile(`\D`)
+	reS := regexp.MustCompile(`\D+`)
 	for _, val := range s.When {
-		var unitVal = reS.FindString(val)
-		var offsetVal = reI.FindString(val)
-		var vals = []string{offsetVal, unitVal}
+		if strings.HasPrefix(val, AbsolutePrefix) {
+			var atVal = val[len(AbsolutePrefix):]
+			absTime, err := time.Parse(AbsoluteLayout, atVal)
+			if err == nil {
+				atVal = absTime.Format("01/02/2006 3:04pm")
+			}
+
+			result[val] = []string{"0", AbsolutePrefix, atVal}
+			continue
+		}
+
+		// Follow-ups keep their marker on the unit, e.g. "+1d" is {"1", "+d"}
+		var prefix string
+		var offset = val
+		if strings.HasPrefix(offset, FollowUpPrefix) {
+			prefix = FollowUpPrefix
+			offset = offset[len(FollowUpPrefix):]
+		}
+
+		var unitVal = prefix + reS.FindString(offset)
+		var offsetVal = reI.FindString(offset)
+		var vals = []string{offsetVal, unitVal, ""}
 
 		result[val] = vals
 	}
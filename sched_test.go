@@ -0,0 +1,82 @@
+package orgreminders
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScheduleTooLate(t *testing.T) {
+	var due = time.Date(2014, 3, 3, 9, 0, 0, 0, time.UTC)
+	var s = Schedule{When: []string{"1d", "+1d", "+8w", "+9w", "+57d", "+1400h", "@2014-06-01 09:00", "@2014-02-01 09:00"}}
+
+	want := []string{"+1400h", "+57d", "+9w", "@2014-06-01 09:00"}
+	if got := s.TooLate(due, Calendar{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("TooLate = %q, want %q", got, want)
+	}
+}
+
+func TestValidateFollowUps(t *testing.T) {
+	var now = time.Date(2014, 3, 1, 9, 0, 0, 0, time.UTC)
+	var e = Event{
+		Due:       time.Date(2014, 3, 3, 9, 0, 0, 0, time.UTC),
+		Reminders: Schedule{When: []string{"1d", "+8w", "+39bd"}},
+	}
+	var ops = Organization{Name: "Ops"}
+
+	if errs := e.ValidateFollowUps([]Organization{ops}, now); len(errs) > 0 {
+		t.Errorf("follow-ups within the window: %v", errs)
+	}
+
+	// Holidays push business days out, past the window for this org only
+	var holidays = Organization{Name: "Support", Holidays: []string{"2014-04-18", "2014-04-21", "2014-05-26"}}
+	msg := e.ValidateFollowUps([]Organization{ops, holidays}, now)["reminders"]
+	if want := "Follow-up reminder(s) more than 8 weeks after the due date: +39bd"; msg != want {
+		t.Errorf("follow-up past the org's window: error %q, want %q", msg, want)
+	}
+
+	e.Reminders.Add("+60d")
+	if msg := e.ValidateFollowUps([]Organization{ops}, now)["reminders"]; !strings.Contains(msg, "+60d") {
+		t.Errorf("follow-up past the window: error %q, want +60d named", msg)
+	}
+}
+
+func TestScheduleTimesDST(t *testing.T) {
+	chicago, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Skip("no time zone data")
+	}
+
+	var tests = []struct {
+		name string
+		due  time.Time
+		when string
+		want time.Time
+	}{
+		// Spring forward, 2014-03-09 02:00 CST becomes 03:00 CDT
+		{"day before spring", time.Date(2014, 3, 9, 9, 0, 0, 0, chicago), "1d", time.Date(2014, 3, 8, 9, 0, 0, 0, chicago)},
+		{"week before spring", time.Date(2014, 3, 12, 9, 0, 0, 0, chicago), "1w", time.Date(2014, 3, 5, 9, 0, 0, 0, chicago)},
+		{"follow-up across spring", time.Date(2014, 3, 8, 9, 0, 0, 0, chicago), "+1d", time.Date(2014, 3, 9, 9, 0, 0, 0, chicago)},
+		{"business day across spring", time.Date(2014, 3, 10, 9, 0, 0, 0, chicago), "1bd", time.Date(2014, 3, 7, 9, 0, 0, 0, chicago)},
+		{"hours across spring", time.Date(2014, 3, 9, 9, 0, 0, 0, chicago), "24h", time.Date(2014, 3, 8, 8, 0, 0, 0, chicago)},
+
+		// Fall back, 2014-11-02 02:00 CDT becomes 01:00 CST
+		{"day before fall", time.Date(2014, 11, 2, 9, 0, 0, 0, chicago), "1d", time.Date(2014, 11, 1, 9, 0, 0, 0, chicago)},
+		{"week before fall", time.Date(2014, 11, 5, 9, 0, 0, 0, chicago), "1w", time.Date(2014, 10, 29, 9, 0, 0, 0, chicago)},
+		{"follow-up across fall", time.Date(2014, 11, 1, 9, 0, 0, 0, chicago), "+1d", time.Date(2014, 11, 2, 9, 0, 0, 0, chicago)},
+		{"hours across fall", time.Date(2014, 11, 2, 9, 0, 0, 0, chicago), "24h", time.Date(2014, 11, 1, 10, 0, 0, 0, chicago)},
+
+		// Absolute entries are wall clock times in the event's zone
+		{"absolute in summer time", time.Date(2014, 3, 12, 9, 0, 0, 0, chicago), "@2014-03-10 09:00", time.Date(2014, 3, 10, 9, 0, 0, 0, chicago)},
+		{"absolute in winter time", time.Date(2014, 11, 5, 9, 0, 0, 0, chicago), "@2014-11-03 09:00", time.Date(2014, 11, 3, 9, 0, 0, 0, chicago)},
+	}
+
+	for _, test := range tests {
+		var s = Schedule{When: []string{test.when}}
+		got := s.Times(test.due, Calendar{})[test.when]
+		if !got.Equal(test.want) {
+			t.Errorf("%s: Times(%v)[%q] = %v, want %v", test.name, test.due, test.when, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package orgreminders
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"sync"
+)
+
+// Random key used to sign links that are handed out to members.
+type AppSecret struct {
+	Value []byte
+}
+
+var secretMu sync.Mutex
+var secretCache []byte
+
+// Fetch the signing secret, generating and storing one on first use.
+func signingSecret(c appengine.Context) ([]byte, error) {
+	secretMu.Lock()
+	defer secretMu.Unlock()
+
+	if secretCache != nil {
+		return secretCache, nil
+	}
+
+	var secret AppSecret
+	key := datastore.NewKey(c, "AppSecret", "signing", 0, nil)
+	err := datastore.RunInTransaction(c, func(tc appengine.Context) error {
+		err := datastore.Get(tc, key, &secret)
+		if err != datastore.ErrNoSuchEntity {
+			return err
+		}
+
+		secret.Value = make([]byte, 32)
+		if _, err := rand.Read(secret.Value); err != nil {
+			return err
+		}
+
+		_, err = datastore.Put(tc, key, &secret)
+		return err
+	}, nil)
+
+	if err != nil {
+		c.Errorf("signingSecret error: %v", err)
+		return nil, err
+	}
+
+	secretCache = secret.Value
+	return secretCache, nil
+}
+
+// Sign the given values, returning a URL-safe signature.
+func Sign(c appengine.Context, parts ...string) string {
+	secret, err := signingSecret(c)
+	if err != nil {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strings.Join(parts, "|")))
+	return base64.URLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Check a signature produced by Sign.
+func VerifySignature(c appengine.Context, sig string, parts ...string) bool {
+	expected := Sign(c, parts...)
+	if expected == "" {
+		return false
+	}
+
+	return hmac.Equal([]byte(sig), []byte(expected))
+}
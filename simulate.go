@@ -0,0 +1,109 @@
+package orgreminders
+
+import (
+	"appengine"
+	"sort"
+	"time"
+)
+
+// A single reminder that fires (or would fire) for an event.
+type Reminder struct {
+	EventKey      string
+	Title         string
+	Org           string
+	Offset        string
+	Channel       string
+	When          time.Time
+	WhenFormatted string
+	Recipients    []string
+}
+
+type Reminders []Reminder
+
+func (slice Reminders) Len() int {
+	return len(slice)
+}
+
+func (slice Reminders) Less(i, j int) bool {
+	return slice[i].When.Before(slice[j].When)
+}
+
+func (slice Reminders) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+// List every reminder that would fire between from and to (exclusive)
+// without sending anything. Each minute an event has a reminder is run
+// through Event.Notify as a dry run, so acks, digests, quiet hours,
+// unsubscribes and chat posts are accounted for as the cron would.
+// Snoozes and held back reminders already waiting are included as well.
+func Simulate(c appengine.Context, from time.Time, to time.Time) Reminders {
+	var result = Reminders{}
+	var orgs = make(map[string]Organization)
+	var within = func(t time.Time) bool {
+		return !t.Before(from) && t.Before(to)
+	}
+
+	events := GetAllEvents(c, FixedClock(from), true) // active only
+	for _, event := range events {
+		okay, fullevent := GetEventByKey(c, event.Key)
+		if okay != true {
+			c.Infof("Simulate: Error querying for event %s", event.Key)
+			continue
+		}
+
+		location := fullevent.Location(c)
+		var due = fullevent.Due.In(location)
+
+		// Minutes the event fires in for any of its orgs
+		var minutes = make(map[time.Time]bool)
+		for _, orgname := range fullevent.Orgs {
+			o, found := orgs[orgname]
+			if !found {
+				var oerr error
+				o, oerr = GetOrganizationByName(c, orgname)
+				if oerr != nil {
+					c.Infof("Simulate: Error looking up org: %s. Skipping this organization.", orgname)
+					continue
+				}
+				orgs[orgname] = o
+			}
+
+			for _, ttime := range fullevent.Reminders.Times(due, o.Calendar()) {
+				if when := ttime.Truncate(time.Minute); within(when) {
+					minutes[when] = true
+				}
+			}
+		}
+
+		for when := range minutes {
+			_, reminders := fullevent.Notify(c, FixedClock(when), false, true)
+			for _, reminder := range reminders {
+				if within(reminder.When) {
+					result = append(result, reminder)
+				}
+			}
+		}
+	}
+
+	// Anything already waiting goes out on the first run it is due for
+	var at = func(until time.Time) time.Time {
+		if until.Before(from) {
+			return from
+		}
+		return until.Truncate(time.Minute)
+	}
+	for _, snooze := range GetDueSnoozes(c, FixedClock(to)) {
+		if when := at(snooze.Until); within(when) {
+			result = append(result, SendSnooze(c, FixedClock(when), snooze, true)...)
+		}
+	}
+	for _, deferral := range GetDueDeferrals(c, FixedClock(to)) {
+		if when := at(deferral.Until); within(when) {
+			result = append(result, SendDeferral(c, FixedClock(when), deferral, true)...)
+		}
+	}
+
+	sort.Sort(result)
+	return result
+}
@@ -0,0 +1,286 @@
+package orgreminders
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"crypto/hmac"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// What to do with text messages longer than the organization's limit.
+const (
+	SMSTruncate = "truncate" // cut short, ending with a link to the full message
+	SMSSplit    = "split"    // send as numbered parts
+)
+
+const (
+	EncodingGSM7 = "GSM-7"
+	EncodingUCS2 = "UCS-2"
+)
+
+// Characters of the GSM 03.38 default alphabet, and the extension table
+// characters that take two septets.
+const (
+	gsm7Basic     = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	gsm7Extension = "\f^{}\\[~]|€"
+)
+
+// Size of a text message as the carrier sees it.
+type SMSInfo struct {
+	Encoding   string
+	Characters int
+	Units      int // septets for GSM-7, UTF-16 code units for UCS-2
+	Segments   int
+	Remaining  int // units left in the last segment
+}
+
+// Work out the encoding and number of SMS segments text needs.
+func MeasureSMS(text string) SMSInfo {
+	var info = SMSInfo{Encoding: EncodingGSM7, Characters: utf8.RuneCountInString(text)}
+
+	for _, r := range text {
+		if !strings.ContainsRune(gsm7Basic, r) && !strings.ContainsRune(gsm7Extension, r) {
+			info.Encoding = EncodingUCS2
+			break
+		}
+	}
+
+	ucs2 := info.Encoding == EncodingUCS2
+	info.Units = smsLength(text, ucs2)
+
+	single, multi := smsSegmentSize(ucs2)
+	switch {
+	case info.Units == 0:
+		info.Segments = 0
+		info.Remaining = single
+	case info.Units <= single:
+		info.Segments = 1
+		info.Remaining = single - info.Units
+	default:
+		info.Segments = (info.Units + multi - 1) / multi
+		info.Remaining = info.Segments*multi - info.Units
+	}
+
+	return info
+}
+
+func smsUnits(r rune, ucs2 bool) int {
+	if ucs2 {
+		if r > 0xFFFF {
+			return 2 // surrogate pair
+		}
+		return 1
+	}
+
+	if strings.ContainsRune(gsm7Extension, r) {
+		return 2
+	}
+	return 1
+}
+
+// Units in a single message, and in each part of a concatenated one.
+func smsSegmentSize(ucs2 bool) (int, int) {
+	if ucs2 {
+		return 70, 67
+	}
+	return 160, 153
+}
+
+// Units allowed in one text for a limit given in (GSM-7) characters. UCS-2
+// texts get the same number of segments, which hold fewer characters.
+func smsUnitLimit(limit int, ucs2 bool) int {
+	if !ucs2 {
+		return limit
+	}
+
+	segments := 1
+	if limit > 160 {
+		segments = (limit + 152) / 153
+	}
+
+	single, multi := smsSegmentSize(true)
+	capacity := single
+	if segments > 1 {
+		capacity = segments * multi
+	}
+	if limit < capacity {
+		return limit
+	}
+	return capacity
+}
+
+// Fewest units of the message that are worth sending next to the link.
+// Below that the link is left out.
+const smsMinBody = 20
+
+// The texts to send for text, each within limit characters. A link (to
+// the full message) is added at the end. Longer texts are cut short
+// before the link or split into numbered parts, depending on policy. The
+// link is never broken up; when it leaves no room for the message it is
+// left out.
+func SMSParts(text string, limit int, policy string, link string) []string {
+	var body = strings.TrimSpace(text)
+	var full = body
+	if link != "" {
+		full = strings.TrimSpace(body + "\n" + link)
+	}
+
+	info := MeasureSMS(full)
+	ucs2 := info.Encoding == EncodingUCS2
+	max := smsUnitLimit(limit, ucs2)
+	if limit <= 0 || info.Units <= max {
+		return []string{full}
+	}
+
+	if policy == SMSSplit {
+		return smsSplit(body, link, max, ucs2)
+	}
+
+	return smsTruncate(body, link, max, ucs2)
+}
+
+// Cut body short to fit max units, ending with "..." and the link.
+func smsTruncate(body string, link string, max int, ucs2 bool) []string {
+	var suffix = "..."
+	if link != "" {
+		suffix += " " + link
+	}
+	if max-smsLength(suffix, ucs2) < smsMinBody {
+		suffix = "..."
+	}
+	head, _ := smsCut(body, max-smsLength(suffix, ucs2), ucs2)
+	return []string{strings.TrimRight(head, " \n.,;:") + suffix}
+}
+
+// Units text takes in the given encoding.
+func smsLength(text string, ucs2 bool) int {
+	var units int
+
+	for _, r := range text {
+		units += smsUnits(r, ucs2)
+	}
+
+	return units
+}
+
+// Split body into parts of at most max units, each numbered "(1/3) ". The
+// link goes whole at the end of the last part, or in a part of its own.
+func smsSplit(body string, link string, max int, ucs2 bool) []string {
+	var parts []string
+
+	// Numbering takes more room once there are 10 or more parts
+	for count := 2; ; {
+		room := max - len(fmt.Sprintf("(%d/%d) ", count, count))
+		if room < 10 {
+			// Too little room to be worth splitting, but still within limit
+			return smsTruncate(body, link, max, ucs2)
+		}
+
+		parts = nil
+		rest := body
+		for rest != "" {
+			var part string
+			part, rest = smsCut(rest, room, ucs2)
+			parts = append(parts, part)
+		}
+
+		if link != "" {
+			last := len(parts) - 1
+			switch {
+			case last >= 0 && smsLength(parts[last]+"\n"+link, ucs2) <= room:
+				parts[last] += "\n" + link
+			case smsLength(link, ucs2) <= room:
+				parts = append(parts, link)
+			}
+		}
+
+		if len(strconv.Itoa(len(parts))) <= len(strconv.Itoa(count)) {
+			break
+		}
+		count = len(parts)
+	}
+
+	for indx := range parts {
+		parts[indx] = fmt.Sprintf("(%d/%d) %s", indx+1, len(parts), parts[indx])
+	}
+
+	return parts
+}
+
+// Take as much of text as fits in room units, breaking between words when
+// possible. Returns the piece and what is left.
+func smsCut(text string, room int, ucs2 bool) (string, string) {
+	var used, end, space int
+
+	for i, r := range text {
+		units := smsUnits(r, ucs2)
+		if used+units > room {
+			break
+		}
+		used += units
+		end = i + utf8.RuneLen(r)
+		if unicode.IsSpace(r) {
+			space = i
+		}
+	}
+
+	if end >= len(text) {
+		return text, ""
+	}
+	if space > end/2 {
+		end = space
+	}
+
+	return strings.TrimSpace(text[:end]), strings.TrimSpace(text[end:])
+}
+
+// Short link to a page showing the full event message to one member, with
+// the acknowledgement links. Numeric IDs and a shortened signature keep it
+// small enough for a text.
+func MessageLink(c appengine.Context, eventKey string, memberKey string) string {
+	var eventID, memberID int64
+
+	if key, err := datastore.DecodeKey(eventKey); err == nil {
+		eventID = key.IntID()
+	}
+	if key, err := datastore.DecodeKey(memberKey); err == nil {
+		memberID = key.IntID()
+	}
+
+	return messageURL(c, eventID, memberID)
+}
+
+func messageURL(c appengine.Context, eventID int64, memberID int64) string {
+	e := strconv.FormatInt(eventID, 10)
+	m := strconv.FormatInt(memberID, 10)
+
+	return fmt.Sprintf("https://%s/m/%s/%s/%s", appengine.DefaultVersionHostname(c), e, m, messageSignature(c, e, m))
+}
+
+// Characters of the signature kept in message links: 22 base64
+// characters, over 16 bytes of the HMAC. Texts have little room, but the
+// link shows the whole message and leads to the ack actions, so it has to
+// be as hard to guess as any other signed link.
+const messageSignatureLength = 22
+
+func messageSignature(c appengine.Context, eventID string, memberID string) string {
+	sig := Sign(c, "message", eventID, memberID)
+	if len(sig) > messageSignatureLength {
+		sig = sig[:messageSignatureLength]
+	}
+
+	return sig
+}
+
+func verifyMessageSignature(c appengine.Context, sig string, eventID string, memberID string) bool {
+	expected := messageSignature(c, eventID, memberID)
+	if expected == "" {
+		return false
+	}
+
+	return hmac.Equal([]byte(sig), []byte(expected))
+}
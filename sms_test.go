@@ -0,0 +1,174 @@
+package orgreminders
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const testSMSLink = "https://orgreminders.appspot.com/m/5629499534213120/5639445604728832/abcdefghijklmnopqrstuv"
+
+func TestMeasureSMS(t *testing.T) {
+	var tests = []struct {
+		name string
+		in   string
+		want SMSInfo
+	}{
+		{"empty", "", SMSInfo{EncodingGSM7, 0, 0, 0, 160}},
+		{"ascii", "Meeting at 5", SMSInfo{EncodingGSM7, 12, 12, 1, 148}},
+		{"gsm accents", "Café à Genève", SMSInfo{EncodingGSM7, 13, 13, 1, 147}},
+		{"gsm extension", "{x} €5 [a|b] ~^\\", SMSInfo{EncodingGSM7, 16, 25, 1, 135}},
+		{"ucs2 accent", "Zoë", SMSInfo{EncodingUCS2, 3, 3, 1, 67}},
+		{"ucs2 extension counts once", "Zoë {€}", SMSInfo{EncodingUCS2, 7, 7, 1, 63}},
+		{"ucs2 surrogate pair", "ok 👍", SMSInfo{EncodingUCS2, 4, 5, 1, 65}},
+		{"gsm single full", strings.Repeat("a", 160), SMSInfo{EncodingGSM7, 160, 160, 1, 0}},
+		{"gsm two parts", strings.Repeat("a", 161), SMSInfo{EncodingGSM7, 161, 161, 2, 145}},
+		{"gsm two parts full", strings.Repeat("a", 306), SMSInfo{EncodingGSM7, 306, 306, 2, 0}},
+		{"gsm three parts", strings.Repeat("a", 307), SMSInfo{EncodingGSM7, 307, 307, 3, 152}},
+		{"gsm extension over", strings.Repeat("a", 159) + "€", SMSInfo{EncodingGSM7, 160, 161, 2, 145}},
+		{"ucs2 single full", strings.Repeat("ж", 70), SMSInfo{EncodingUCS2, 70, 70, 1, 0}},
+		{"ucs2 two parts", strings.Repeat("ж", 71), SMSInfo{EncodingUCS2, 71, 71, 2, 63}},
+		{"ucs2 two parts full", strings.Repeat("ж", 134), SMSInfo{EncodingUCS2, 134, 134, 2, 0}},
+		{"ucs2 three parts", strings.Repeat("ж", 135), SMSInfo{EncodingUCS2, 135, 135, 3, 66}},
+	}
+
+	for _, test := range tests {
+		if got := MeasureSMS(test.in); got != test.want {
+			t.Errorf("%s: MeasureSMS(%q) = %+v, want %+v", test.name, test.in, got, test.want)
+		}
+	}
+}
+
+// Words "w1 w2 w3 ..." up to n.
+func testWords(n int) string {
+	var words []string
+
+	for i := 1; i <= n; i++ {
+		words = append(words, fmt.Sprintf("w%d", i))
+	}
+
+	return strings.Join(words, " ")
+}
+
+func TestSMSPartsFits(t *testing.T) {
+	var text = "Meeting at 5"
+
+	got := SMSParts(text, 160, SMSTruncate, testSMSLink)
+	if len(got) != 1 || got[0] != text+"\n"+testSMSLink {
+		t.Errorf("SMSParts = %q, want the text and link in one message", got)
+	}
+
+	got = SMSParts(strings.Repeat("ж", 134), 306, SMSSplit, "")
+	if len(got) != 1 {
+		t.Errorf("134 UCS-2 units in two segments: got %d parts, want 1", len(got))
+	}
+	got = SMSParts(strings.Repeat("ж", 135), 306, SMSSplit, "")
+	if len(got) != 2 {
+		t.Errorf("135 UCS-2 units in two segments: got %d parts, want 2", len(got))
+	}
+}
+
+func TestSMSPartsTruncate(t *testing.T) {
+	var tests = []struct {
+		name     string
+		text     string
+		limit    int
+		link     string
+		wantLink bool
+	}{
+		{"gsm with link", testWords(100), 160, testSMSLink, true},
+		{"gsm without link", testWords(100), 160, "", false},
+		{"gsm extension", strings.Repeat("{} ", 100), 160, testSMSLink, true},
+		{"ucs2 with link", strings.Repeat("жж ", 100), 320, testSMSLink, true},
+		{"ucs2 link too long", strings.Repeat("жж ", 100), 160, testSMSLink, false},
+		{"limit near link length", testWords(100), 100, testSMSLink, false},
+		{"limit below link length", testWords(100), 60, testSMSLink, false},
+		{"minimum limit", testWords(100), 20, testSMSLink, false},
+	}
+
+	for _, test := range tests {
+		got := SMSParts(test.text, test.limit, SMSTruncate, test.link)
+		if len(got) != 1 {
+			t.Errorf("%s: got %d messages, want 1", test.name, len(got))
+			continue
+		}
+
+		info := MeasureSMS(got[0])
+		if max := smsUnitLimit(test.limit, info.Encoding == EncodingUCS2); info.Units > max {
+			t.Errorf("%s: %d units, limit %d: %q", test.name, info.Units, max, got[0])
+		}
+		if hasLink := strings.HasSuffix(got[0], "... "+test.link); test.link != "" && hasLink != test.wantLink {
+			t.Errorf("%s: ends with link %v, want %v: %q", test.name, hasLink, test.wantLink, got[0])
+		}
+		if !strings.Contains(got[0], "...") || strings.HasPrefix(got[0], "...") {
+			t.Errorf("%s: want some of the text and a cut mark: %q", test.name, got[0])
+		}
+		if test.link != "" && !test.wantLink && strings.Contains(got[0], "https:") {
+			t.Errorf("%s: contains part of the link: %q", test.name, got[0])
+		}
+	}
+}
+
+func TestSMSPartsSplit(t *testing.T) {
+	var tests = []struct {
+		name     string
+		text     string
+		limit    int
+		link     string
+		parts    int
+		withLink bool
+	}{
+		{"two parts", testWords(60), 160, "", 2, false},
+		{"link in last part", testWords(55), 160, testSMSLink, 2, true},
+		{"link in own part", testWords(60), 160, testSMSLink, 3, true},
+		{"over nine parts", testWords(500), 160, testSMSLink, 17, true},
+		{"gsm extension", strings.Repeat("{} ", 100), 160, "", 4, false},
+		{"ucs2", strings.Repeat("жж ", 60), 320, testSMSLink, 2, true},
+		{"ucs2 link too long", strings.Repeat("жж ", 60), 160, testSMSLink, 3, false},
+		{"link too long", testWords(40), 60, testSMSLink, 3, false},
+	}
+
+	for _, test := range tests {
+		got := SMSParts(test.text, test.limit, SMSSplit, test.link)
+		if len(got) != test.parts {
+			t.Errorf("%s: got %d parts, want %d: %q", test.name, len(got), test.parts, got)
+		}
+
+		var words []string
+		for indx, part := range got {
+			prefix := fmt.Sprintf("(%d/%d) ", indx+1, len(got))
+			if !strings.HasPrefix(part, prefix) {
+				t.Errorf("%s: part %d does not start with %q: %q", test.name, indx+1, prefix, part)
+			}
+
+			info := MeasureSMS(part)
+			if max := smsUnitLimit(test.limit, info.Encoding == EncodingUCS2); info.Units > max {
+				t.Errorf("%s: part %d has %d units, limit %d: %q", test.name, indx+1, info.Units, max, part)
+			}
+
+			words = append(words, strings.Fields(strings.TrimPrefix(part, prefix))...)
+		}
+
+		// Nothing lost, nothing broken up, the link whole at the end
+		want := strings.Fields(test.text)
+		if test.withLink {
+			want = append(want, test.link)
+		}
+		if strings.Join(words, " ") != strings.Join(want, " ") {
+			t.Errorf("%s: parts do not add up to the text and link: %q", test.name, got)
+		}
+	}
+}
+
+func TestSMSPartsSplitNoRoom(t *testing.T) {
+	for _, limit := range []int{12, 15} {
+		got := SMSParts(testWords(100), limit, SMSSplit, testSMSLink)
+		if len(got) != 1 {
+			t.Errorf("limit %d: got %d parts, want the text cut short: %q", limit, len(got), got)
+			continue
+		}
+		if info := MeasureSMS(got[0]); info.Units > limit || !strings.HasSuffix(got[0], "...") {
+			t.Errorf("limit %d: %q is %d units", limit, got[0], info.Units)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package orgreminders
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var timeZonesOnce sync.Once
+var timeZones []string
+
+// Whether name is an IANA time zone the server knows about.
+func ValidTimeZone(name string) bool {
+	if name == "" || name == "Local" {
+		return false
+	}
+
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// All IANA time zone names found in the server's tzdata, sorted.
+func TimeZones() []string {
+	timeZonesOnce.Do(func() {
+		var found = map[string]bool{"UTC": true}
+
+		// System zoneinfo directories
+		for _, dir := range []string{os.Getenv("ZONEINFO"), "/usr/share/zoneinfo", "/usr/share/lib/zoneinfo", "/usr/lib/locale/TZ"} {
+			if dir == "" {
+				continue
+			}
+			filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+				if err != nil || info.IsDir() {
+					return nil
+				}
+				name, _ := filepath.Rel(dir, path)
+				found[filepath.ToSlash(name)] = true
+				return nil
+			})
+		}
+
+		// The copy shipped with Go
+		if z, err := zip.OpenReader(filepath.Join(runtime.GOROOT(), "lib", "time", "zoneinfo.zip")); err == nil {
+			for _, f := range z.File {
+				found[f.Name] = true
+			}
+			z.Close()
+		}
+
+		for name := range found {
+			// Skip helper files and legacy aliases such as "EST5EDT" or "posix/..."
+			if strings.HasPrefix(name, "posix/") || strings.HasPrefix(name, "right/") {
+				continue
+			}
+			if strings.Contains(name, "/") == false && name != "UTC" {
+				continue
+			}
+			if ValidTimeZone(name) {
+				timeZones = append(timeZones, name)
+			}
+		}
+		sort.Strings(timeZones)
+	})
+
+	return timeZones
+}
+
+// Organizations whose stored time zone is missing or invalid, by key.
+func GetInvalidTimeZoneOrgs(c appengine.Context) map[string]Organization {
+	var dbResults []Organization
+	mapResults := make(map[string]Organization)
+
+	q := datastore.NewQuery("Organization")
+	keys, err := q.GetAll(c, &dbResults)
+	if err != nil {
+		c.Infof("GetInvalidTimeZoneOrgs DB lookup error: %v", err)
+	}
+
+	for indx, org := range dbResults {
+		if ValidTimeZone(org.TimeZone) == false {
+			mapResults[keys[indx].Encode()] = org
+		}
+	}
+
+	return mapResults
+}
@@ -0,0 +1,140 @@
+package orgreminders
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"fmt"
+	netmail "net/mail"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// A member's email or text reminders being switched on or off, and what
+// did it.
+type SubscriptionChange struct {
+	Member  string
+	Name    string
+	Org     string
+	Channel string
+	On      bool
+	Source  string
+	When    time.Time
+}
+
+func (s SubscriptionChange) Save(c appengine.Context) bool {
+	key := datastore.NewIncompleteKey(c, "SubscriptionChange", nil)
+	_, err := datastore.Put(c, key, &s)
+	if err != nil {
+		c.Errorf("SubscriptionChange.Save error: %v", err)
+		return false
+	}
+
+	return true
+}
+
+// Subscription changes of a member, newest first.
+func GetSubscriptionChanges(c appengine.Context, memberKey string) []SubscriptionChange {
+	var dbResults []SubscriptionChange
+
+	q := datastore.NewQuery("SubscriptionChange").Filter("Member = ", memberKey)
+	_, err := q.GetAll(c, &dbResults)
+	if err != nil {
+		c.Infof("GetSubscriptionChanges DB lookup error: %v", err)
+	}
+
+	sort.Sort(SubscriptionChanges(dbResults))
+	return dbResults
+}
+
+type SubscriptionChanges []SubscriptionChange
+
+func (slice SubscriptionChanges) Len() int           { return len(slice) }
+func (slice SubscriptionChanges) Less(i, j int) bool { return slice[i].When.After(slice[j].When) }
+func (slice SubscriptionChanges) Swap(i, j int)      { slice[i], slice[j] = slice[j], slice[i] }
+
+// Whether the member gets reminders over channel t ("email" or "text").
+func (m Member) Subscribed(t string) bool {
+	if t == "text" {
+		return m.TextOn
+	}
+
+	return m.EmailOn
+}
+
+// Whether the member unsubscribed from org's reminders over channel t.
+func (m Member) OptedOut(org string, t string) bool {
+	for _, entry := range m.Unsubscribed {
+		if entry == org+"/"+t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Address the member gets org's reminders at over channel t, blank when
+// the channel is off or they unsubscribed from org on it.
+func (m Member) OrgAddress(org string, t string) string {
+	if m.OptedOut(org, t) {
+		return ""
+	}
+
+	return m.Address(t)
+}
+
+// Stop org's reminders over channel t for a stored member and record the
+// change. Without an org (links in digests, which cover all of them) the
+// member is unsubscribed from each of their organizations. Their other
+// organizations and channels are left alone.
+func (m *Member) Unsubscribe(c appengine.Context, t string, org string, source string, now time.Time) bool {
+	var orgs = []string{org}
+	if org == "" {
+		orgs = m.Orgs
+	}
+
+	var changed bool
+	for _, orgname := range orgs {
+		if m.OptedOut(orgname, t) == false {
+			m.Unsubscribed = append(m.Unsubscribed, orgname+"/"+t)
+			changed = true
+		}
+	}
+	if changed == false {
+		return true
+	}
+	if m.Update(c, m.Key) == false {
+		return false
+	}
+
+	change := SubscriptionChange{
+		Member:  m.Key,
+		Name:    m.Name,
+		Org:     org,
+		Channel: t,
+		On:      false,
+		Source:  source,
+		When:    now.UTC(),
+	}
+	return change.Save(c)
+}
+
+// Signed link that stops channel t for a member, from a message sent on
+// behalf of org.
+func UnsubscribeLink(c appengine.Context, memberKey string, org string, t string) string {
+	v := url.Values{}
+	v.Set("m", memberKey)
+	v.Set("o", org)
+	v.Set("t", t)
+	v.Set("s", Sign(c, "unsubscribe", memberKey, org, t))
+
+	return fmt.Sprintf("https://%s/unsubscribe?%s", appengine.DefaultVersionHostname(c), v.Encode())
+}
+
+// RFC 8058 one-click unsubscribe headers for link.
+func UnsubscribeHeaders(link string) netmail.Header {
+	return netmail.Header{
+		"List-Unsubscribe":      []string{"<" + link + ">"},
+		"List-Unsubscribe-Post": []string{"List-Unsubscribe=One-Click"},
+	}
+}
@@ -0,0 +1,37 @@
+package orgreminders
+
+import "testing"
+
+func TestOrgAddress(t *testing.T) {
+	m := Member{
+		Email:        "a@example.com",
+		TextAddr:     "5555555555@txt.example.com",
+		EmailOn:      true,
+		TextOn:       true,
+		Orgs:         []string{"Ops", "Dev/Test"},
+		Unsubscribed: []string{"Ops/email", "Dev/Test/text"},
+	}
+
+	var tests = []struct {
+		org     string
+		channel string
+		want    string
+	}{
+		{"Ops", "email", ""},
+		{"Ops", "text", "5555555555@txt.example.com"},
+		{"Dev/Test", "email", "a@example.com"},
+		{"Dev/Test", "text", ""},
+		{"Dev", "text", "5555555555@txt.example.com"},
+	}
+
+	for _, test := range tests {
+		if got := m.OrgAddress(test.org, test.channel); got != test.want {
+			t.Errorf("OrgAddress(%q, %q) = %q, want %q", test.org, test.channel, got, test.want)
+		}
+	}
+
+	m.EmailOn = false
+	if got := m.OrgAddress("Dev/Test", "email"); got != "" {
+		t.Errorf("email off: OrgAddress = %q, want none", got)
+	}
+}
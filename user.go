@@ -51,3 +51,18 @@ func UserLookup(w http.ResponseWriter, r *http.Request) User {
 
 	return u
 }
+
+// Whether the user may manage the named organization.
+func (u User) Administers(orgname string) bool {
+	if u.SuperUser {
+		return true
+	}
+
+	for _, org := range u.Orgs {
+		if org.Name == orgname {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,232 @@
+package orgreminders
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Problems found in a submitted form, keyed by form field name.
+type FieldErrors map[string]string
+
+// Record a problem with field, keeping the first one found.
+func (f FieldErrors) Add(field string, msg string) {
+	if _, found := f[field]; !found {
+		f[field] = msg
+	}
+}
+
+// Merge the problems of another form check into this one.
+func (f FieldErrors) Merge(other FieldErrors) {
+	for field, msg := range other {
+		f.Add(field, msg)
+	}
+}
+
+var reEmail = regexp.MustCompile(`^[^@\s<>(),;:"]+@[^@\s<>(),;:"]+\.[^@\s<>(),;:".]+$`)
+
+// Whether addr looks like a plain email address.
+func ValidEmail(addr string) bool {
+	return reEmail.MatchString(addr)
+}
+
+var rePhone = regexp.MustCompile(`^[\d\s().+-]+$`)
+
+// Whether cell looks like a 10 digit (optionally 1-prefixed) phone number.
+func ValidPhone(cell string) bool {
+	if rePhone.MatchString(cell) == false {
+		return false
+	}
+
+	rp := regexp.MustCompile("[^\\d]")
+	number := rp.ReplaceAllString(cell, "")
+
+	return len(number) == 10 || (len(number) == 11 && number[0] == '1')
+}
+
+// Check a submitted event. New events must be due after now.
+func (e Event) Validate(now time.Time) FieldErrors {
+	var errs = FieldErrors{}
+
+	if strings.TrimSpace(e.Title) == "" {
+		errs.Add("title", "A title is required.")
+	}
+
+	if len(e.Orgs) < 1 {
+		errs.Add("orgs", "You must choose an organization.")
+	}
+
+	if e.TimeZone != "" && ValidTimeZone(e.TimeZone) == false {
+		errs.Add("timezone", "Unknown time zone, pick one from the list.")
+	}
+
+	if e.Key == "" && e.Due.IsZero() == false && e.Due.After(now) == false {
+		errs.Add("due", "The due date must be in the future.")
+	}
+
+	if invalid := e.Reminders.Invalid(); len(invalid) > 0 {
+		errs.Add("reminders", "Invalid reminder(s): "+strings.Join(invalid, ", "))
+	}
+
+	if e.EscalateAfter < 0 {
+		errs.Add("escalateafter", "Escalation delay cannot be negative.")
+	}
+
+	return errs
+}
+
+// Check that no follow-up fires past FollowUpWindow for any of the
+// event's orgs, counting business days on each org's own calendar.
+func (e Event) ValidateFollowUps(orgs []Organization, now time.Time) FieldErrors {
+	var errs = FieldErrors{}
+	var window = FollowUpWindow.String()
+	if FollowUpWindow%(7*24*time.Hour) == 0 {
+		window = fmt.Sprintf("%d weeks", FollowUpWindow/(7*24*time.Hour))
+	}
+
+	var due = e.Due
+	if due.IsZero() {
+		due = now
+	}
+	due = due.In(now.Location())
+
+	for _, o := range orgs {
+		if late := e.Reminders.TooLate(due, o.Calendar()); len(late) > 0 {
+			errs.Add("reminders", "Follow-up reminder(s) more than "+window+" after the due date: "+strings.Join(late, ", "))
+		}
+	}
+
+	return errs
+}
+
+// Check the event's escalation backups, loaded and keyed by member key.
+// Backups are reminded through the event's orgs, so each one has to be in
+// at least one of them.
+func (e Event) ValidateBackups(backups map[string]Member) FieldErrors {
+	var errs = FieldErrors{}
+
+	for _, key := range e.Backups {
+		member, found := backups[key]
+		if found == false {
+			errs.Add("backups", "A backup member no longer exists, please choose again.")
+			continue
+		}
+		var shared bool
+		for _, morg := range member.Orgs {
+			for _, eorg := range e.Orgs {
+				shared = shared || morg == eorg
+			}
+		}
+		if shared == false {
+			errs.Add("backups", "Backup "+member.Name+" is not in any of the event's organizations.")
+		}
+	}
+
+	return errs
+}
+
+// Check a submitted organization.
+func (o Organization) Validate() FieldErrors {
+	var errs = FieldErrors{}
+
+	if strings.TrimSpace(o.Name) == "" {
+		errs.Add("name", "A name is required.")
+	}
+
+	if ValidTimeZone(o.TimeZone) == false {
+		errs.Add("timezone", "Unknown time zone \""+o.TimeZone+"\", pick one from the list (e.g. America/Chicago).")
+	}
+
+	if o.Quiet().Valid() == false {
+		errs.Add("quiet", "Quiet hours must be given as HH:MM (24 hour).")
+	}
+
+	for _, holiday := range o.Holidays {
+		if len(holiday) < len(HolidayLayout) {
+			errs.Add("holidays", "Invalid holiday, expected YYYY-MM-DD: "+holiday)
+			continue
+		}
+		if _, err := time.Parse(HolidayLayout, holiday[:len(HolidayLayout)]); err != nil {
+			errs.Add("holidays", "Invalid holiday, expected YYYY-MM-DD: "+holiday)
+		}
+	}
+
+	if o.SMSLength != 0 && (o.SMSLength < 20 || o.SMSLength > 1600) {
+		errs.Add("smslength", "Text length must be between 20 and 1600 characters.")
+	}
+
+	if o.SMSPolicy != "" && o.SMSPolicy != SMSTruncate && o.SMSPolicy != SMSSplit {
+		errs.Add("smspolicy", "Unknown policy for long texts.")
+	}
+
+	// Webhook URLs are secrets, so errors only show where they point
+	for indx, line := range o.ChatWebhooks {
+		if hook, err := ParseChatHook(line); err != nil {
+			where := strings.TrimSpace(hook.String())
+			if where == "" {
+				where = "line " + strconv.Itoa(indx+1)
+			}
+			errs.Add("chathooks", "Invalid chat webhook ("+where+"): "+err.Error()+".")
+		}
+	}
+
+	if len(o.Administrator) == 0 {
+		errs.Add("admin", "At least one administrator is required.")
+	}
+	for _, admin := range o.Administrator {
+		if ValidEmail(admin) == false {
+			errs.Add("admin", "Invalid administrator email address: "+admin)
+		}
+	}
+
+	return errs
+}
+
+// Check a submitted member.
+func (m Member) Validate() FieldErrors {
+	var errs = FieldErrors{}
+
+	if strings.TrimSpace(m.Name) == "" {
+		errs.Add("name", "A name is required.")
+	}
+
+	if m.Email != "" && ValidEmail(m.Email) == false {
+		errs.Add("email", "Invalid email address.")
+	} else if m.Email == "" && (m.EmailOn || m.WebUser) {
+		errs.Add("email", "An email address is required to receive email.")
+	}
+
+	if m.Cell != "" && ValidPhone(m.Cell) == false {
+		errs.Add("cell", "Invalid cell number, expected 10 digits.")
+	} else if m.Cell == "" && m.TextOn {
+		errs.Add("cell", "A cell number is required to receive texts.")
+	}
+
+	if m.TextOn && m.Cell != "" && m.TextAddr == "" {
+		errs.Add("carrier", "A carrier is required to receive texts.")
+	}
+
+	if len(m.Orgs) == 0 && m.WebUser == false {
+		errs.Add("orgs", "Cannot save without an organization.")
+	}
+
+	if (QuietHours{Start: m.QuietStart, End: m.QuietEnd}).Valid() == false {
+		errs.Add("quiet", "Quiet hours must be given as HH:MM (24 hour).")
+	}
+
+	if m.TimeZone != "" && ValidTimeZone(m.TimeZone) == false {
+		errs.Add("timezone", "Unknown time zone, pick one from the list.")
+	}
+
+	if m.Digest != "" && m.Digest != DigestDaily && m.Digest != DigestWeekly {
+		errs.Add("digest", "Unknown digest frequency.")
+	} else if m.Digest != "" && m.Email == "" {
+		errs.Add("email", "An email address is required to receive a digest.")
+	} else if m.Digest != "" && m.EmailOn == false {
+		errs.Add("digest", "A digest is sent by email, turn on Receive Email to get one.")
+	}
+
+	return errs
+}
@@ -0,0 +1,478 @@
+package orgreminders
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"appengine/delay"
+	"appengine/urlfetch"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Lifecycle notifications an endpoint can subscribe to.
+const (
+	HookEventCreated   = "event.created"
+	HookEventUpdated   = "event.updated"
+	HookEventDeleted   = "event.deleted"
+	HookReminderSent   = "reminder.sent"
+	HookReminderFailed = "reminder.failed"
+)
+
+var HookTypes = []string{HookEventCreated, HookEventUpdated, HookEventDeleted, HookReminderSent, HookReminderFailed}
+
+// Headers sent with every delivery. The signature is
+// "t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<body>">", keyed with
+// the endpoint's secret.
+const (
+	HookSignatureHeader = "X-OrgReminders-Signature"
+	HookTypeHeader      = "X-OrgReminders-Event"
+	HookDeliveryHeader  = "X-OrgReminders-Delivery"
+)
+
+// Wait before each retry of a failed delivery. A delivery is given up on
+// once these are used up.
+var DeliveryBackoff = []time.Duration{
+	time.Minute,
+	5 * time.Minute,
+	30 * time.Minute,
+	2 * time.Hour,
+	12 * time.Hour,
+}
+
+// How long a queued attempt has before the cron job queues it again.
+const deliveryLease = 10 * time.Minute
+
+// Delivery attempts run from the task queue, so neither the request that
+// fired them nor the cron job waits on slow endpoints.
+var deliverLater = delay.Func("deliver", deliverTask)
+
+// An organization's webhook endpoint.
+type Endpoint struct {
+	Key     string `datastore:"-"`
+	Org     string
+	URL     string
+	Secret  string `datastore:",noindex"`
+	Types   []string
+	Created time.Time
+}
+
+// One notification for one endpoint, kept along with its attempts.
+type Delivery struct {
+	Key         string `datastore:"-"`
+	Endpoint    string
+	Org         string
+	URL         string
+	Type        string
+	Payload     []byte
+	Created     time.Time
+	Attempts    int
+	NextAttempt time.Time
+	Done        bool
+	Status      string
+	StatusCode  int
+	History     []string `datastore:",noindex"`
+}
+
+// Body of every delivery.
+type HookPayload struct {
+	Type    string      `json:"type"`
+	Created time.Time   `json:"created"`
+	Org     string      `json:"org"`
+	Data    interface{} `json:"data"`
+}
+
+// Event as described to webhooks.
+type HookEvent struct {
+	Key      string    `json:"key"`
+	Title    string    `json:"title"`
+	Due      time.Time `json:"due,omitempty"`
+	TimeZone string    `json:"timezone,omitempty"`
+	Orgs     []string  `json:"orgs"`
+	Channels []string  `json:"channels"`
+	Urgent   bool      `json:"urgent"`
+}
+
+// Reminder as described to webhooks.
+type HookReminder struct {
+	Event      string    `json:"event"`
+	Title      string    `json:"title"`
+	Offset     string    `json:"offset"`
+	Channel    string    `json:"channel"`
+	When       time.Time `json:"when"`
+	Recipients []string  `json:"recipients"`
+}
+
+func NewEndpoint(org string, address string, types []string) (Endpoint, error) {
+	var e = Endpoint{Org: org, URL: address, Types: types, Created: time.Now().UTC()}
+
+	u, err := url.Parse(address)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return e, errors.New("Webhook URL must be an http(s) address.")
+	}
+	if len(types) == 0 {
+		return e, errors.New("Pick at least one notification to send.")
+	}
+	for _, t := range types {
+		if subscribed(HookTypes, t) == false {
+			return e, errors.New("Unknown notification " + t)
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return e, err
+	}
+	e.Secret = hex.EncodeToString(secret)
+
+	return e, nil
+}
+
+func subscribed(types []string, t string) bool {
+	for _, s := range types {
+		if s == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Save a new endpoint to the database
+func (e Endpoint) Save(c appengine.Context) bool {
+	key := datastore.NewIncompleteKey(c, "Endpoint", nil)
+	_, err := datastore.Put(c, key, &e)
+	if err != nil {
+		c.Errorf("Endpoint.Save error: %v", err)
+		return false
+	}
+
+	return true
+}
+
+// Remove an endpoint. Its delivery history is kept.
+func DeleteEndpoint(c appengine.Context, key string) bool {
+	keyObj, decerr := datastore.DecodeKey(key)
+	if decerr != nil {
+		c.Infof("Invalid endpoint key specified: %s", key)
+		return false
+	}
+
+	if err := datastore.Delete(c, keyObj); err != nil {
+		c.Errorf("DeleteEndpoint error: %v", err)
+		return false
+	}
+
+	return true
+}
+
+func GetEndpointByKey(c appengine.Context, key string) (bool, Endpoint) {
+	var result Endpoint
+
+	keyObj, decerr := datastore.DecodeKey(key)
+	if decerr != nil {
+		c.Infof("Invalid endpoint key specified: %s", key)
+		return false, result
+	}
+
+	if err := datastore.Get(c, keyObj, &result); err != nil {
+		c.Infof("GetEndpointByKey DB lookup error: %v", err)
+		return false, result
+	}
+
+	result.Key = key
+	return true, result
+}
+
+// Webhook endpoints of an organization.
+func GetEndpoints(c appengine.Context, org string) []Endpoint {
+	var dbResults []Endpoint
+
+	q := datastore.NewQuery("Endpoint").Filter("Org = ", org)
+	keys, err := q.GetAll(c, &dbResults)
+	if err != nil {
+		c.Infof("GetEndpoints DB lookup error: %v", err)
+	}
+
+	for indx := range dbResults {
+		dbResults[indx].Key = keys[indx].Encode()
+	}
+
+	return dbResults
+}
+
+// Most recent deliveries for an organization, newest first.
+func GetDeliveries(c appengine.Context, org string, limit int) []Delivery {
+	var dbResults []Delivery
+
+	q := datastore.NewQuery("Delivery").Filter("Org = ", org).Order("-Created").Limit(limit)
+	keys, err := q.GetAll(c, &dbResults)
+	if err != nil {
+		c.Infof("GetDeliveries DB lookup error: %v", err)
+	}
+
+	for indx := range dbResults {
+		dbResults[indx].Key = keys[indx].Encode()
+	}
+
+	return dbResults
+}
+
+func GetDeliveryByKey(c appengine.Context, key string) (bool, Delivery) {
+	var result Delivery
+
+	keyObj, decerr := datastore.DecodeKey(key)
+	if decerr != nil {
+		c.Infof("Invalid delivery key specified: %s", key)
+		return false, result
+	}
+
+	if err := datastore.Get(c, keyObj, &result); err != nil {
+		c.Infof("GetDeliveryByKey DB lookup error: %v", err)
+		return false, result
+	}
+
+	result.Key = key
+	return true, result
+}
+
+func (d *Delivery) Save(c appengine.Context) bool {
+	var key *datastore.Key
+	var err error
+
+	if d.Key == "" {
+		key = datastore.NewIncompleteKey(c, "Delivery", nil)
+	} else if key, err = datastore.DecodeKey(d.Key); err != nil {
+		c.Infof("Invalid delivery key specified: %s", d.Key)
+		return false
+	}
+
+	key, err = datastore.Put(c, key, d)
+	if err != nil {
+		c.Errorf("Delivery.Save error: %v", err)
+		return false
+	}
+
+	d.Key = key.Encode()
+	return true
+}
+
+// Add an entry to the delivery history.
+func (d *Delivery) Log(when time.Time, format string, args ...interface{}) {
+	var entry = when.UTC().Format("01/02/2006 3:04pm MST") + ": " + fmt.Sprintf(format, args...)
+	d.History = append(d.History, entry)
+}
+
+// Notify the organization's endpoints subscribed to t. Each gets its own
+// delivery, queued to be tried right away and retried from the cron job
+// if it fails.
+func FireWebhook(c appengine.Context, clock Clock, org string, t string, data interface{}) {
+	var now = clock.Now().UTC()
+	var endpoints []Endpoint
+
+	for _, endpoint := range GetEndpoints(c, org) {
+		if subscribed(endpoint.Types, t) {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	if len(endpoints) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(HookPayload{Type: t, Created: now, Org: org, Data: data})
+	if err != nil {
+		c.Errorf("FireWebhook: Couldn't encode %s: %v", t, err)
+		return
+	}
+
+	for _, endpoint := range endpoints {
+		d := Delivery{
+			Endpoint:    endpoint.Key,
+			Org:         org,
+			URL:         endpoint.URL,
+			Type:        t,
+			Payload:     payload,
+			Created:     now,
+			NextAttempt: now.Add(deliveryLease),
+			Status:      "pending",
+		}
+
+		// Saved first so the attempt can send its ID
+		if d.Save(c) {
+			d.Enqueue(c)
+		}
+	}
+}
+
+// Queue an attempt at a saved delivery. Until the lease given to it by
+// NextAttempt runs out, the cron job leaves it to the queue.
+func (d *Delivery) Enqueue(c appengine.Context) {
+	if err := deliverLater.Call(c, d.Key); err != nil {
+		c.Errorf("Couldn't queue %s delivery to %s: %v", d.Type, d.URL, err)
+	}
+}
+
+// Make a queued delivery attempt.
+func deliverTask(c appengine.Context, key string) {
+	okay, d := GetDeliveryByKey(c, key)
+	if okay == false || d.Done {
+		return
+	}
+
+	if okay, endpoint := GetEndpointByKey(c, d.Endpoint); okay {
+		d.Attempt(c, SystemClock, endpoint)
+	} else {
+		// The endpoint was removed in the meantime
+		d.Done = true
+		d.Status = "cancelled"
+		d.Log(SystemClock.Now(), "endpoint removed, not retrying")
+	}
+
+	d.Save(c)
+}
+
+// Notify an event's organizations about it.
+func FireEventWebhook(c appengine.Context, clock Clock, t string, e Event) {
+	data := HookEvent{
+		Key:      e.Key,
+		Title:    e.Title,
+		Due:      e.Due.UTC(),
+		TimeZone: e.TimeZone,
+		Orgs:     e.Orgs,
+		Channels: e.Channels(),
+		Urgent:   e.Urgent,
+	}
+
+	for _, org := range e.Orgs {
+		FireWebhook(c, clock, org, t, data)
+	}
+}
+
+// Notify the reminder's organizations that it went out, or failed to.
+func FireReminderWebhook(c appengine.Context, clock Clock, orgs []string, r Reminder, ok bool) {
+	var t = HookReminderSent
+	if ok == false {
+		t = HookReminderFailed
+	}
+
+	data := HookReminder{
+		Event:      r.EventKey,
+		Title:      r.Title,
+		Offset:     r.Offset,
+		Channel:    r.Channel,
+		When:       r.When.UTC(),
+		Recipients: r.Recipients,
+	}
+
+	for _, org := range orgs {
+		FireWebhook(c, clock, org, t, data)
+	}
+}
+
+// Make one delivery attempt, scheduling the next one if it fails.
+func (d *Delivery) Attempt(c appengine.Context, clock Clock, endpoint Endpoint) {
+	d.post(urlfetch.Client(c), clock.Now().UTC(), endpoint)
+
+	if d.Status == "failed" {
+		c.Infof("Giving up on %s delivery to %s after %d attempts", d.Type, d.URL, d.Attempts)
+	}
+}
+
+// Make one attempt at now through client and record how it went.
+func (d *Delivery) post(client *http.Client, now time.Time, endpoint Endpoint) {
+	d.Attempts++
+	code, err := PostWebhook(client, d.URL, endpoint.Secret, d.Key, d.Type, d.Payload, now)
+	d.StatusCode = code
+
+	switch {
+	case err == nil:
+		d.Done = true
+		d.Status = "delivered"
+		d.Log(now, "%d %s", code, http.StatusText(code))
+		return
+	case code != 0:
+		d.Log(now, "%d %s", code, http.StatusText(code))
+	default:
+		d.Log(now, "%v", err)
+	}
+
+	if d.Attempts > len(DeliveryBackoff) {
+		d.Done = true
+		d.Status = "failed"
+		return
+	}
+
+	d.Status = "retrying"
+	d.NextAttempt = now.Add(DeliveryBackoff[d.Attempts-1])
+}
+
+// POST a signed payload to address, returning the response code. Anything
+// but a 2xx response is an error.
+func PostWebhook(client *http.Client, address string, secret string, id string, t string, payload []byte, now time.Time) (int, error) {
+	req, err := http.NewRequest("POST", address, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HookTypeHeader, t)
+	req.Header.Set(HookDeliveryHeader, id)
+	req.Header.Set(HookSignatureHeader, SignWebhook(secret, payload, now))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, errors.New(resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// Signature header value for payload sent at now.
+func SignWebhook(secret string, payload []byte, now time.Time) string {
+	var timestamp = strconv.FormatInt(now.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Queue the deliveries that are due another attempt.
+func RetryDeliveries(c appengine.Context, clock Clock, dryrun bool) {
+	var dbResults []Delivery
+	var now = clock.Now().UTC()
+
+	q := datastore.NewQuery("Delivery").Filter("Done = ", false).Filter("NextAttempt <=", now)
+	keys, err := q.GetAll(c, &dbResults)
+	if err != nil {
+		c.Infof("RetryDeliveries DB lookup error: %v", err)
+	}
+
+	for indx, d := range dbResults {
+		if dryrun {
+			c.Infof("dry run, not retrying %s delivery to %s", d.Type, d.URL)
+			continue
+		}
+
+		d.Key = keys[indx].Encode()
+		d.NextAttempt = now.Add(deliveryLease)
+		if d.Save(c) {
+			d.Enqueue(c)
+		}
+	}
+}
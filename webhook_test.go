@@ -0,0 +1,138 @@
+package orgreminders
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var testHookTime = time.Date(2014, 3, 10, 14, 30, 0, 0, time.UTC)
+
+func TestSignWebhook(t *testing.T) {
+	var payload = []byte(`{"type":"event.created"}`)
+
+	got := SignWebhook("s3cret", payload, testHookTime)
+	m := regexp.MustCompile(`^t=(\d+),v1=([0-9a-f]{64})$`).FindStringSubmatch(got)
+	if m == nil {
+		t.Fatalf("SignWebhook = %q, want t=<unix time>,v1=<hex sha256>", got)
+	}
+	if m[1] != strconv.FormatInt(testHookTime.Unix(), 10) {
+		t.Errorf("timestamp %s, want %d", m[1], testHookTime.Unix())
+	}
+
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(m[1] + "." + string(payload)))
+	if want := hex.EncodeToString(mac.Sum(nil)); m[2] != want {
+		t.Errorf("v1=%s, want %s", m[2], want)
+	}
+
+	if SignWebhook("other", payload, testHookTime) == got {
+		t.Errorf("signature does not depend on the secret")
+	}
+	if SignWebhook("s3cret", payload, testHookTime.Add(time.Second)) == got {
+		t.Errorf("signature does not depend on the time")
+	}
+}
+
+// A webhook receiver answering with status that checks what it is sent
+// the way a client would.
+func testHookServer(t *testing.T, status int, secret string) (*httptest.Server, *int) {
+	var calls int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := ioutil.ReadAll(r.Body)
+
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s with content type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		if r.Header.Get(HookTypeHeader) != HookEventCreated || r.Header.Get(HookDeliveryHeader) != "delivery-1" {
+			t.Errorf("type %q delivery %q", r.Header.Get(HookTypeHeader), r.Header.Get(HookDeliveryHeader))
+		}
+
+		var sig = r.Header.Get(HookSignatureHeader)
+		m := regexp.MustCompile(`^t=(\d+),v1=([0-9a-f]+)$`).FindStringSubmatch(sig)
+		if m == nil {
+			t.Errorf("signature header %q", sig)
+		} else {
+			mac := hmac.New(sha256.New, []byte(secret))
+			mac.Write([]byte(m[1] + "."))
+			mac.Write(body)
+			if !hmac.Equal([]byte(m[2]), []byte(hex.EncodeToString(mac.Sum(nil)))) {
+				t.Errorf("signature %q does not match the body", sig)
+			}
+		}
+
+		w.WriteHeader(status)
+	}))
+
+	return server, &calls
+}
+
+func testDelivery(url string) Delivery {
+	return Delivery{Key: "delivery-1", URL: url, Type: HookEventCreated, Payload: []byte(`{"type":"event.created"}`)}
+}
+
+func TestDeliveryDelivered(t *testing.T) {
+	var endpoint = Endpoint{Secret: "s3cret"}
+	server, calls := testHookServer(t, http.StatusNoContent, endpoint.Secret)
+	defer server.Close()
+
+	d := testDelivery(server.URL)
+	d.post(http.DefaultClient, testHookTime, endpoint)
+
+	if *calls != 1 || !d.Done || d.Status != "delivered" || d.StatusCode != http.StatusNoContent || d.Attempts != 1 {
+		t.Errorf("after a 204: calls %d done %v status %q code %d attempts %d", *calls, d.Done, d.Status, d.StatusCode, d.Attempts)
+	}
+}
+
+func TestDeliveryRetries(t *testing.T) {
+	var endpoint = Endpoint{Secret: "s3cret"}
+	server, calls := testHookServer(t, http.StatusServiceUnavailable, endpoint.Secret)
+	defer server.Close()
+
+	d := testDelivery(server.URL)
+	var now = testHookTime
+	for indx, wait := range DeliveryBackoff {
+		d.post(http.DefaultClient, now, endpoint)
+
+		if d.Done || d.Status != "retrying" || d.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("attempt %d: done %v status %q code %d", indx+1, d.Done, d.Status, d.StatusCode)
+		}
+		if want := now.Add(wait); !d.NextAttempt.Equal(want) {
+			t.Errorf("attempt %d: next attempt %v, want %v", indx+1, d.NextAttempt, want)
+		}
+		now = d.NextAttempt
+	}
+
+	// Backoff used up, the next failure is the last
+	var next = d.NextAttempt
+	d.post(http.DefaultClient, now, endpoint)
+	if !d.Done || d.Status != "failed" || d.Attempts != len(DeliveryBackoff)+1 {
+		t.Errorf("last attempt: done %v status %q attempts %d", d.Done, d.Status, d.Attempts)
+	}
+	if !d.NextAttempt.Equal(next) {
+		t.Errorf("last attempt scheduled another at %v", d.NextAttempt)
+	}
+	if *calls != len(DeliveryBackoff)+1 || len(d.History) != *calls {
+		t.Errorf("%d calls and %d history entries, want %d", *calls, len(d.History), len(DeliveryBackoff)+1)
+	}
+}
+
+func TestDeliveryUnreachable(t *testing.T) {
+	server, _ := testHookServer(t, http.StatusOK, "")
+	server.Close()
+
+	d := testDelivery(server.URL)
+	d.post(http.DefaultClient, testHookTime, Endpoint{})
+	if d.Done || d.Status != "retrying" || d.StatusCode != 0 || !d.NextAttempt.Equal(testHookTime.Add(DeliveryBackoff[0])) {
+		t.Errorf("unreachable endpoint: done %v status %q code %d next %v", d.Done, d.Status, d.StatusCode, d.NextAttempt)
+	}
+}